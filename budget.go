@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"math"
+	"time"
+)
+
+// execBudget dispatches operations for as long as the budget function
+// permits at t. Budget that accumulated while the scheduler was paused or
+// idle is capped at what a single tick grants, so it can't cause a burst.
+// It returns whether an operation was dispatched.
+func (s *Scheduler) execBudget(t time.Time) bool {
+	s.mu.Lock()
+	elapsed := t.Sub(s.budgetStart)
+	prev := elapsed - s.interval
+	if prev < 0 {
+		prev = 0
+	}
+	avail := s.budgetFn(elapsed) - s.budgetUsed
+	if limit := math.Max(1, s.budgetFn(elapsed)-s.budgetFn(prev)); avail > limit {
+		s.budgetUsed += avail - limit
+		avail = limit
+	}
+	s.mu.Unlock()
+
+	executed, empty := false, false
+	for ; avail >= 1; avail-- {
+		q, ok := s.getNextOp()
+		if !ok {
+			empty = true
+			break
+		}
+		s.mu.Lock()
+		s.budgetUsed++
+		s.mu.Unlock()
+		s.dispatch(s.prepare(q), q.priority)
+		executed = true
+	}
+	if empty && !executed {
+		s.runFallback()
+	}
+	return executed
+}
@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerBudget(t *testing.T) {
+	rl := newManual(Config{Budget: func(elapsed time.Duration) float64 {
+		if elapsed < 100*time.Millisecond {
+			return 1
+		}
+		return 5
+	}})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	executed := 0
+	for i := 0; i < 10; i++ {
+		rl.Add(1, Closure(func() { executed++ }))
+	}
+
+	rl.tick(rl.budgetStart.Add(10 * time.Millisecond))
+	rl.tick(rl.budgetStart.Add(20 * time.Millisecond))
+	if executed != 1 {
+		t.Fatal("budget should allow a single operation", executed)
+	}
+	rl.tick(rl.budgetStart.Add(150 * time.Millisecond))
+	if executed != 5 {
+		t.Fatal("budget should open more capacity after the threshold", executed)
+	}
+}
+
+func TestSchedulerBudgetNoBurst(t *testing.T) {
+	fallbacks := 0
+	rl := newManual(Config{
+		OPS:      10,
+		Budget:   func(elapsed time.Duration) float64 { return 10 * elapsed.Seconds() },
+		Fallback: Closure(func() { fallbacks++ }),
+	})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	executed := 0
+	for i := 0; i < 100; i++ {
+		rl.Add(1, Closure(func() { executed++ }))
+	}
+
+	rl.tick(rl.budgetStart.Add(5 * time.Second))
+	if executed != 1 {
+		t.Fatal("budget accumulated while idle must not cause a burst", executed)
+	}
+	rl.tick(rl.budgetStart.Add(5*time.Second + 50*time.Millisecond))
+	if executed != 1 || fallbacks != 0 {
+		t.Fatal("the fallback must not run while operations are pending", executed, fallbacks)
+	}
+	rl.tick(rl.budgetStart.Add(5*time.Second + 100*time.Millisecond))
+	if executed != 2 {
+		t.Fatal("the budget of the next tick should be available", executed)
+	}
+}
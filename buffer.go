@@ -0,0 +1,46 @@
+package scheduler
+
+import "sync"
+
+// priorityBuffer holds the dispatched operations in order of priority
+// when per-priority execution buffers are used. The execution buffer then
+// only transfers the buffer itself as a token to the workers, which execute
+// the buffered operation with the most urgent priority when they receive it.
+// This way a high priority operation never waits behind lower priority
+// operations that were dispatched earlier.
+type priorityBuffer struct {
+	mu         sync.Mutex
+	ops        []queuedOp // Sorted from the most to the least urgent priority, FIFO within a priority.
+	lowerFirst bool       // Whether lower values are more urgent.
+}
+
+// push adds a dispatched operation to the buffer.
+func (b *priorityBuffer) push(o Operation, p Priority) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := len(b.ops)
+	for i > 0 && b.before(p, b.ops[i-1].priority) {
+		i--
+	}
+	b.ops = append(b.ops, queuedOp{})
+	copy(b.ops[i+1:], b.ops[i:])
+	b.ops[i] = queuedOp{op: o, priority: p}
+}
+
+// before returns whether priority p is more urgent than priority q.
+func (b *priorityBuffer) before(p, q Priority) bool {
+	if b.lowerFirst {
+		return p < q
+	}
+	return p > q
+}
+
+// Execute executes the buffered operation with the most urgent priority.
+func (b *priorityBuffer) Execute() {
+	b.mu.Lock()
+	o := b.ops[0].op
+	b.ops[0] = queuedOp{}
+	b.ops = b.ops[1:]
+	b.mu.Unlock()
+	o.Execute()
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import "sync"
+
+// BurstAllocator allocates bursts of additional operations on top of the
+// regular rate of a Scheduler. It holds a budget of extra operations which
+// is consumed by every burst that is granted.
+//
+// A burst doesn't change the rate of the scheduler, the additional operations
+// are dispatched immediately, after which the scheduler simply continues at
+// its configured rate.
+type BurstAllocator struct {
+	s      *Scheduler
+	mu     sync.Mutex
+	budget int
+}
+
+// NewBurstAllocator creates a new BurstAllocator for the scheduler with the
+// specified budget of extra operations.
+func NewBurstAllocator(s *Scheduler, budget int) *BurstAllocator {
+	return &BurstAllocator{
+		s:      s,
+		budget: budget,
+	}
+}
+
+// GrantBurst immediately dispatches up to n pending operations, limited by
+// the remaining budget and the amount of pending operations. It returns
+// the amount of operations that were dispatched.
+// When the scheduler doesn't use workers, the operations are executed
+// synchronously from within the calling goroutine. A configured Executor is
+// called from within the calling goroutine as well, and MinInterval doesn't
+// apply to the burst. Operations that are taken while the scheduler stops
+// are dropped with DropStopped.
+func (b *BurstAllocator) GrantBurst(n int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > b.budget {
+		n = b.budget
+	}
+
+	granted := 0
+	for ; granted < n; granted++ {
+		q, ok := b.s.getNextOp()
+		if !ok {
+			break
+		}
+		if !b.s.dispatch(b.s.prepare(q), q.priority) {
+			b.s.drop([]queuedOp{q}, DropStopped)
+			break
+		}
+	}
+	b.budget -= granted
+	return granted
+}
+
+// Refill adds n operations to the budget.
+func (b *BurstAllocator) Refill(n int) {
+	b.mu.Lock()
+	b.budget += n
+	b.mu.Unlock()
+}
+
+// Budget returns the remaining budget of extra operations.
+func (b *BurstAllocator) Budget() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.budget
+}
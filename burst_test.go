@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBurstAllocator(t *testing.T) {
+	rl := New(Config{OPS: 0.5, Workers: 2})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	var executed int32
+	for i := 0; i < 10; i++ {
+		rl.Add(1, Closure(func() { atomic.AddInt32(&executed, 1) }))
+	}
+
+	b := NewBurstAllocator(rl, 7)
+	if n := b.GrantBurst(5); n != 5 {
+		t.Fatal("expected a burst of 5, got", n)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&executed); n != 5 {
+		t.Fatal("expected 5 near-immediate executions, got", n)
+	}
+
+	if n := b.GrantBurst(5); n != 2 {
+		t.Fatal("burst should be limited by the budget, got", n)
+	}
+	if b.Budget() != 0 {
+		t.Fatal("budget should be exhausted")
+	}
+
+	b.Refill(10)
+	if n := b.GrantBurst(10); n != 3 {
+		t.Fatal("burst should be limited by the pending operations, got", n)
+	}
+	if b.Budget() != 7 {
+		t.Fatal("wrong remaining budget", b.Budget())
+	}
+}
+
+func TestBurstAllocatorStopped(t *testing.T) {
+	rl := newManual(Config{Workers: 1})
+	rl.InitPriority(1, 0)
+	rl.Add(1, &testOp{})
+
+	// The burst takes the operation right before Stop closes the workers.
+	q, _ := rl.getNextOp()
+	rl.Stop()
+	if rl.dispatch(rl.prepare(q), q.priority) {
+		t.Fatal("dispatch after Stop should fail instead of panicking")
+	}
+}
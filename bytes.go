@@ -0,0 +1,68 @@
+package scheduler
+
+// Sized is an operation that reports its size in bytes, which is used by
+// schedulers that limit the amount of bytes per tick.
+type Sized interface {
+	Size() int
+}
+
+// sizeOf returns the size of an operation, operations that don't implement
+// Sized have a size of 1. The size of wrapped operations, e.g. those added
+// using AddErr, is the size of the operation that was added.
+func sizeOf(o Operation) int {
+	if so, ok := unwrap(o).(Sized); ok {
+		return so.Size()
+	}
+	return 1
+}
+
+// fits returns whether the byte budget covers the operation and consumes
+// its size if so. Otherwise, no other operations may be dispatched during
+// the current tick so that large operations aren't starved.
+// The caller must hold the lock.
+func (s *Scheduler) fits(o Operation) bool {
+	if s.overBudget {
+		return false
+	}
+	n := sizeOf(o)
+	if n > s.budget {
+		s.overBudget = true
+		return false
+	}
+	s.budget -= n
+	return true
+}
+
+// execBytes dispatches operations for as long as the byte budget, which is
+// replenished on every tick, covers their size. The remainder of the budget
+// carries over to the next tick as long as operations are pending. It
+// returns whether an operation was dispatched.
+func (s *Scheduler) execBytes() bool {
+	s.mu.Lock()
+	s.budget += s.bytesPerTick
+	s.overBudget = false
+	s.mu.Unlock()
+
+	executed := false
+	for {
+		q, ok := s.getNextOp()
+		if !ok {
+			break
+		}
+		s.dispatch(s.prepare(q), q.priority)
+		executed = true
+	}
+
+	s.mu.Lock()
+	if s.curops == 0 && s.budget > s.bytesPerTick {
+		s.budget = s.bytesPerTick
+	}
+	// The queue isn't empty when the next operation exceeds the budget.
+	empty := !s.overBudget
+	s.mu.Unlock()
+
+	if !executed && empty {
+		s.runFallback()
+	}
+	return executed
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+type sizedOp struct {
+	size     int
+	executed *[]int
+}
+
+func (o *sizedOp) Execute() { *o.executed = append(*o.executed, o.size) }
+
+func (o *sizedOp) Size() int { return o.size }
+
+func TestSchedulerBytesPerTick(t *testing.T) {
+	rl := newManual(Config{BytesPerTick: 100})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	var executed []int
+	for _, size := range []int{50, 50, 200, 10} {
+		rl.Add(1, &sizedOp{size, &executed})
+	}
+
+	want := []int{2, 2, 3, 4}
+	for i, n := range want {
+		rl.tick(time.Now())
+		if len(executed) != n {
+			t.Fatal("wrong amount of bytes dispatched at tick", i, executed)
+		}
+	}
+}
+
+func TestSchedulerBytesPerTickFallback(t *testing.T) {
+	fallbacks := 0
+	rl := newManual(Config{BytesPerTick: 100, Fallback: Closure(func() { fallbacks++ })})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	var executed []int
+	rl.Add(1, &sizedOp{250, &executed})
+	rl.tick(time.Now())
+	rl.tick(time.Now())
+	if fallbacks != 0 {
+		t.Fatal("the fallback must not run while an operation waits for budget", fallbacks)
+	}
+	rl.tick(time.Now())
+	rl.tick(time.Now())
+	if len(executed) != 1 || fallbacks != 1 {
+		t.Fatal("the fallback should run once the queue is empty", executed, fallbacks)
+	}
+}
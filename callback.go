@@ -0,0 +1,58 @@
+package scheduler
+
+// AddWithCallback adds a new operation to the scheduler and calls done
+// once the operation has been executed. When the operation is dropped
+// instead, e.g. because it's rejected or expires, done receives a
+// *DropError describing the reason. A rejected operation is both dropped
+// and reported by the returned error. An operation that implements
+// MetaOperation is executed through ExecuteMeta.
+func (s *Scheduler) AddWithCallback(p Priority, o Operation, done func(err error)) error {
+	c := &callbackOperation{o: o, done: done}
+	if _, ok := o.(MetaOperation); ok {
+		return s.Add(p, &callbackMetaOperation{c})
+	}
+	return s.Add(p, c)
+}
+
+// AddErrWithCallback is like AddWithCallback for an operation that can
+// fail. The error returned by the operation is passed to done, as well as
+// to the OnError hook. An operation that requests to be requeued using a
+// RequeueError is requeued first, done is called after its final execution.
+func (s *Scheduler) AddErrWithCallback(p Priority, o ErrorOperation, done func(err error)) error {
+	return s.Add(p, &errorOperation{s: s, p: p, o: o, done: done})
+}
+
+// finisher is an operation that reports when it's done, which includes
+// being dropped.
+type finisher interface {
+	finish(err error)
+}
+
+// callbackOperation calls a function after the execution of an operation.
+type callbackOperation struct {
+	o    Operation
+	done func(error)
+}
+
+func (c *callbackOperation) Execute() {
+	c.o.Execute()
+	c.done(nil)
+}
+
+func (c *callbackOperation) finish(err error) {
+	c.done(err)
+}
+
+func (c *callbackOperation) unwrap() interface{} {
+	return c.o
+}
+
+// callbackMetaOperation is a callbackOperation around a MetaOperation.
+type callbackMetaOperation struct {
+	*callbackOperation
+}
+
+func (c *callbackMetaOperation) ExecuteMeta(m OpMeta) {
+	c.o.(MetaOperation).ExecuteMeta(m)
+	c.done(nil)
+}
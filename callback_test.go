@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSchedulerAddWithCallback(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 1)
+
+	executed := false
+	var errs []error
+	done := func(err error) { errs = append(errs, err) }
+	if err := rl.AddWithCallback(1, Closure(func() { executed = true }), done); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.AddWithCallback(1, &testOp{}, done); err != ErrPriorityCapacity {
+		t.Fatal("the second operation should be rejected", err)
+	}
+	var de *DropError
+	if len(errs) != 1 || !errors.As(errs[0], &de) || de.Reason != DropCapacity {
+		t.Fatal("the callback should receive the drop", errs)
+	}
+
+	rl.tick(time.Now())
+	if !executed || len(errs) != 2 || errs[1] != nil {
+		t.Fatal("the callback should be called after the execution", errs)
+	}
+}
+
+func TestSchedulerAddErrWithCallback(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	fail := errors.New("failed")
+	var errs []error
+	done := func(err error) { errs = append(errs, err) }
+	rl.AddErrWithCallback(1, ClosureErr(func() error { return fail }), done)
+	requeued := false
+	rl.AddErrWithCallback(1, ClosureErr(func() error {
+		if !requeued {
+			requeued = true
+			return ErrRequeue
+		}
+		return nil
+	}), done)
+	for i := 0; i < 3; i++ {
+		rl.tick(time.Now())
+	}
+	if len(errs) != 2 || errs[0] != fail || errs[1] != nil {
+		t.Fatal("the callback should receive the error of the final execution", errs)
+	}
+}
+
+func TestSchedulerAddWithCallbackMeta(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	o := &testMetaOp{meta: make(chan OpMeta, 1)}
+	called := false
+	rl.AddWithCallback(1, o, func(error) { called = true })
+	rl.tick(time.Now())
+	if o.executed || len(o.meta) != 1 || !called {
+		t.Fatal("the operation should be executed through ExecuteMeta")
+	}
+}
@@ -0,0 +1,34 @@
+package scheduler
+
+import "time"
+
+// awaitCapacity blocks until the queue might have room for another
+// operation. It returns false when the timeout fires first.
+func (s *Scheduler) awaitCapacity(timeout <-chan time.Time) bool {
+	s.mu.Lock()
+	if s.curops < s.maxops || s.stopped {
+		s.mu.Unlock()
+		return true
+	}
+	if s.space == nil {
+		s.space = make(chan struct{})
+	}
+	space := s.space
+	s.mu.Unlock()
+
+	select {
+	case <-space:
+		return true
+	case <-timeout:
+		return false
+	}
+}
+
+// freeSpace wakes up the callers that are waiting for room inside the
+// queue. The caller must hold the lock.
+func (s *Scheduler) freeSpace() {
+	if s.space != nil {
+		close(s.space)
+		s.space = nil
+	}
+}
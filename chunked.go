@@ -0,0 +1,36 @@
+package scheduler
+
+// AddChunked adds a new operation that does its work in chunks. Every
+// execution handles a single chunk, after which the operation is added to
+// the back of the same priority again as long as work remains, so long jobs
+// are interleaved with other operations at the rate of the scheduler.
+// When the operation can't be added again, the error is passed to the
+// OnError hook, unless the scheduler has been stopped in the meantime.
+func (s *Scheduler) AddChunked(p Priority, o ChunkedOperation) error {
+	return s.Add(p, &chunkedOperation{s: s, p: p, o: o})
+}
+
+// chunkedOperation adapts a ChunkedOperation to the Operation interface.
+type chunkedOperation struct {
+	s  *Scheduler
+	p  Priority
+	o  ChunkedOperation
+	id OpID // The ID of the last dispatch.
+}
+
+func (c *chunkedOperation) Execute() {
+	if !c.o.Execute() {
+		return
+	}
+	if err := c.s.readd(c.p, c); err != nil && err != ErrStopped {
+		c.s.handleError(err, c.id)
+	}
+}
+
+func (c *chunkedOperation) identify(s *Scheduler, id OpID) {
+	c.s, c.id = s, id
+}
+
+func (c *chunkedOperation) unwrap() interface{} {
+	return c.o
+}
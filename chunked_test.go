@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerAddChunked(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	var order []string
+	chunks := 3
+	rl.AddChunked(1, ClosureChunked(func() bool {
+		order = append(order, "chunk")
+		chunks--
+		return chunks > 0
+	}))
+	rl.Add(1, Closure(func() { order = append(order, "op") }))
+	rl.Add(1, Closure(func() { order = append(order, "op") }))
+
+	for i := 0; i < 6; i++ {
+		rl.tick(time.Now())
+	}
+	want := []string{"chunk", "op", "op", "chunk", "chunk"}
+	if len(order) != len(want) {
+		t.Fatal("wrong executions", order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatal("chunks should interleave with other operations", order)
+		}
+	}
+}
+
+func TestSchedulerAddChunkedStopped(t *testing.T) {
+	var errs []error
+	rl := newManual(Config{OnError: func(err error, _ OpID) { errs = append(errs, err) }})
+	rl.InitPriority(1, 0)
+	rl.AddChunked(1, ClosureChunked(func() bool {
+		go rl.Stop()
+		time.Sleep(10 * time.Millisecond)
+		return true
+	}))
+
+	rl.tick(time.Now())
+	if len(errs) != 0 {
+		t.Fatal("ErrStopped shouldn't be passed to OnError", errs)
+	}
+}
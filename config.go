@@ -1,42 +1,337 @@
 package scheduler
 
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// MaxWorkers is the maximum amount of worker goroutines a Scheduler will
+// spawn. Larger values of Config.Workers are capped to this amount.
+const MaxWorkers = 1024
+
 // Config configures the Ratelimitter.
 type Config struct {
 	// OPS stands for operations per second and is the amount of operations
 	// that the scheduler should allow during the course of one second.
 	OPS float32
 
+	// Budget is an (optional) function that returns how many operations may
+	// have been dispatched in total after the elapsed time since the
+	// scheduler was created. Every tick then dispatches operations for as
+	// long as the budget permits, which allows arbitrary pacing schedules,
+	// e.g. more capacity during off-peak hours. The ticker, running at OPS,
+	// only determines how often the budget is evaluated. Budget that isn't
+	// used, e.g. because the queue is empty or the scheduler is paused, is
+	// only carried over up to what a single tick grants, so it can't cause a
+	// burst. The Fallback only runs when the queue is empty.
+	Budget func(elapsed time.Duration) float64
+
+	// MinInterval is the (optional) minimum time between two dispatched
+	// operations. A tick that occurs sooner after the previous dispatch
+	// doesn't dispatch an operation, which is deferred to the next tick
+	// instead. This prevents dispatches from clustering when ticks are
+	// delayed, e.g. by a slow synchronous operation, or when Unlimited is
+	// set. It doesn't apply to BytesPerTick, Budget, ExecuteNow and
+	// BurstAllocator.GrantBurst.
+	MinInterval time.Duration
+
+	// Unlimited makes the scheduler dispatch operations as fast as the
+	// workers take them, in order of priority, instead of one per tick. The
+	// ticker still runs at OPS, which determines how often the Fallback runs
+	// while the queue is empty and when the scheduler resumes after a pause.
+	Unlimited bool
+
+	// BytesPerTick switches the scheduler to byte rate limiting when it's
+	// greater than 0. Every tick then grants a budget of BytesPerTick bytes
+	// and dispatches operations for as long as the budget covers their size,
+	// which they report by implementing Sized. The remainder of the budget is
+	// carried over to the next tick. Operations that don't implement Sized
+	// have a size of 1. An operation that is larger than BytesPerTick is
+	// dispatched once the budget of multiple ticks covers it.
+	BytesPerTick int
+
+	// Sources are (optional) additional rates that are added to OPS, each
+	// with its own ticker, e.g. to model separate budgets of multiple API
+	// credentials. The ticks of all sources dispatch operations from the same
+	// queue, SourceCounts reports how many operations each source dispatched.
+	// Sources aren't affected by SetRate and WarmUp.
+	Sources []float32
+
+	// WarmUp is the (optional) duration during which the rate increases
+	// linearly from a tenth of OPS to OPS after the scheduler is created.
+	// This avoids hitting a remote rate limit at full speed right away.
+	// Calling SetRate ends the warm-up.
+	WarmUp time.Duration
+
 	// Workers is the amount of goroutine workers that process operations.
 	// If this is 0 then no worker goroutines will be used and operations will
 	// be executed synchronously from within the main tick loop.
+	// Negative values are treated as 0 and values above MaxWorkers are
+	// capped to MaxWorkers.
 	Workers int
 
+	// WorkerLabelPrefix is an (optional) prefix used to label the worker
+	// goroutines in profiles and goroutine dumps. When it's set, every worker
+	// gets the pprof label "worker" with the prefix followed by the index of
+	// the worker, e.g. "scheduler-worker-3".
+	WorkerLabelPrefix string
+
+	// MaxInFlight is the maximum amount of operations that workers are
+	// executing at the same time. When this limit is reached, the main tick
+	// loop blocks until a worker has finished an operation. If this is 0, the
+	// amount of operations in flight is only bound by the amount of workers.
+	// It's only relevant when workers are used.
+	MaxInFlight int
+
+	// PauseHoldsBuffer makes workers hold the operations that have already
+	// been forwarded to them while the scheduler is paused. By default a pause
+	// only stops the main tick loop, so operations inside the execution buffer
+	// are still executed.
+	PauseHoldsBuffer bool
+
+	// Executor is an (optional) function that receives every dispatched
+	// operation and is responsible for executing it, e.g. by handing it to
+	// an existing worker pool. When it is set, no worker goroutines are
+	// started and Workers and ExecutionBufferSize are ignored. It's called
+	// from within the main tick loop, or from the goroutine that calls
+	// BurstAllocator.GrantBurst, and should not block.
+	Executor func(Operation)
+
 	// MaxQueueSize is the maximum size of the operations queue.
 	// This maximum is always enforced, even when priority-specific
 	// queue's have a higher maximum queue size.
 	MaxQueueSize int
 
+	// BlockOnFull makes adding operations block until the queue has room
+	// instead of returning ErrMaxCapacity when MaxQueueSize is reached.
+	// When the capacity of the priority is exceeded, ErrPriorityCapacity is
+	// still returned right away. Operations that the scheduler adds again
+	// itself, i.e. the remaining chunks of AddChunked, the retries of
+	// AddReliable and requeued ErrorOperations, never block: without workers
+	// they're added from within the tick loop, which is the only one that
+	// can make room. When the queue is full, their ErrMaxCapacity is passed
+	// to the OnError hook instead.
+	BlockOnFull bool
+
+	// AddTimeout is the maximum time adding an operation blocks when
+	// BlockOnFull is set, after which ErrMaxCapacity is returned. There's no
+	// timeout when it's 0.
+	AddTimeout time.Duration
+
 	// ExecutionBufferSize is the capacity of the buffered channel which
 	// forwards operations to the various workers.
 	// This should be as low as possible to keep the scheduler in sync with
 	// the remote rate limit window as much as possible.
 	ExecutionBufferSize int
 
+	// OnBufferFull is called from within the main tick loop when an
+	// operation can't be sent to the workers because the execution buffer is
+	// full, right before the loop blocks until a worker takes an operation.
+	// It signals that the workers can't keep up with the rate.
+	OnBufferFull func()
+
+	// PriorityBuffers makes the workers execute the operations inside the
+	// execution buffer in order of priority instead of the order in which
+	// they were dispatched, so a high priority operation doesn't wait behind
+	// lower priority operations that were dispatched earlier.
+	PriorityBuffers bool
+
+	// OnSyncBlock is called from within the main tick loop when an operation
+	// that is executed synchronously, because no workers or Executor are
+	// configured, takes longer than the interval between two ticks. The loop
+	// can't process ticks in the meantime, so the rate isn't met. This
+	// indicates that workers should be used instead.
+	OnSyncBlock func(time.Duration)
+
+	// Selection is the strategy used to select the priority of the next
+	// operation. It defaults to SelectStrict.
+	Selection Selection
+
+	// PriorityOrder determines whether higher or lower priority values are
+	// dispatched first. It defaults to HigherFirst.
+	PriorityOrder PriorityOrder
+
+	// PostPauseFairness makes the scheduler take turns between the priorities
+	// with pending operations after a pause has ended, until the queue has
+	// drained to the depth it had when the pause started. This prevents a
+	// backlog of high priority operations that accumulated during the pause
+	// from starving the lower priorities for a long time. Afterwards the
+	// configured Selection is used again.
+	PostPauseFairness bool
+
+	// Window is the (optional) length of a scheduling window in ticks.
+	// Within a window operations are dispatched strictly by priority, so
+	// Selection and PostPauseFairness don't apply. The quotas set using
+	// SetPriorityQuota are counted per window instead of per their own
+	// duration, and are reset at every window edge. A priority that is
+	// behind its quota is only favored once the remaining ticks of the
+	// window are needed to meet the outstanding quotas, so the more urgent
+	// priorities are served first.
+	Window int
+
+	// Less is an (optional) function that orders the operations inside a
+	// priority, e.g. to dispatch the cheapest operation first. The operation
+	// for which Less returns true against all others is dispatched first.
+	// Priorities are still served in order and operations are dispatched in
+	// FIFO order when Less isn't set. Less is called while the scheduler is
+	// locked, and every dispatch compares all operations of the priority.
+	Less func(a, b QueuedOp) bool
+
+	// Middleware wraps every operation right before it's dispatched, e.g. to
+	// add logging, metrics or tracing. The middleware is applied in order,
+	// so every function wraps the result of the previous one and the last
+	// function is the outermost wrapper. Wrapping happens at dispatch time,
+	// so the operations inside the queue are the ones that were added.
+	// The Fallback isn't wrapped.
+	Middleware []func(Operation) Operation
+
+	// DryRun replaces the execution of every dispatched operation by a call
+	// to OnDryRun, so the queueing and pacing can be verified without side
+	// effects. Everything else, including the middleware, the workers and
+	// the counters, behaves as if the operations were executed.
+	DryRun bool
+
+	// OnDryRun is an (optional) hook that receives every operation that
+	// would have been executed when DryRun is set.
+	OnDryRun func(Operation)
+
 	// Fallback is an (optional) operation that will be executed every time that
 	// no other operations are available. It will be executed from within the
-	// same loop that processes ticks even if there are workers available.
-	// This is by design and allows using this hook to refill the operations
-	// queue whenever it's empty.
+	// same loop that processes ticks even if there are workers available,
+	// unless AsyncFallback is set. This is by design and allows using this
+	// hook to refill the operations queue whenever it's empty.
 	Fallback Operation
 
+	// AsyncFallback dispatches the fallback to the workers like any other
+	// operation instead of executing it from within the tick loop, so a slow
+	// fallback doesn't delay the ticks. Only a single fallback runs at a
+	// time, and the queue may be refilled later than with a synchronous
+	// fallback. It has no effect without workers.
+	AsyncFallback bool
+
+	// FallbackErr is a fallback that can fail, which is used when Fallback
+	// isn't set. Its errors are passed to the OnError hook.
+	FallbackErr ErrorOperation
+
+	// FallbackBreaker optionally stops calling FallbackErr for a while after
+	// it failed repeatedly, e.g. when the source that refills the queue is
+	// down.
+	FallbackBreaker *FallbackBreaker
+
+	// FallbackDuringPause makes the scheduler execute the fallback on every
+	// tick during a pause, even when operations are pending, while it still
+	// doesn't dispatch any operations. Use this when the fallback refills the
+	// queue without touching the rate limited resource, so the queue is full
+	// when the pause ends.
+	FallbackDuringPause bool
+
+	// Overflow is an (optional) second scheduler that receives the operations
+	// that exceed the capacity of this scheduler, either the MaxQueueSize or
+	// the capacity of a priority. Add then returns the result of adding the
+	// operation to the overflow scheduler. Typically the overflow scheduler
+	// runs at a lower rate.
+	Overflow *Scheduler
+
+	// OnError is an (optional) hook that receives the errors returned by
+	// operations that were added using AddErr, the PanicError of operations
+	// added using AddReliable and the errors of FallbackErr. It also receives
+	// the errors that occur when AddAfter, AddChunked, AddReliable or a
+	// requeue add an operation, except ErrStopped. Errors that request the
+	// operation to be requeued aren't passed to OnError. The id is the one
+	// returned by AddID for the failing operation, or 0 when the error isn't
+	// caused by a queued operation.
+	OnError func(err error, id OpID)
+
+	// OnTick is an (optional) hook that is called once at the end of every
+	// tick. The executed argument is true when an operation was dispatched
+	// and false when the tick was idle, paused or ran the fallback. It's
+	// called from within the main tick loop and must return quickly.
+	OnTick func(executed bool)
+
+	// DrainHandler is an (optional) function that receives every operation
+	// that is still pending when the scheduler is stopped, in dispatch order,
+	// instead of those operations being dropped. It can be used to persist
+	// the remaining work. It's called from within Stop. The Fallback can't
+	// serve this purpose as it doesn't receive an operation.
+	DrainHandler func(Operation)
+
+	// OnDrop is an (optional) hook that receives every operation that is
+	// dropped, together with the reason. It's called when an operation is
+	// rejected because of the capacity, when it's removed or expires, and
+	// for the pending operations on Stop when no DrainHandler is configured.
+	// The id is the one returned by AddID, or 0 when the operation was
+	// rejected before it was queued. It's never called while the scheduler
+	// is locked.
+	OnDrop func(o Operation, r DropReason, id OpID)
+
+	// OnStarvation is an (optional) hook that is called from within the main
+	// tick loop when the oldest operation of a priority has waited longer
+	// than StarvationThreshold, e.g. because higher priorities keep the
+	// scheduler busy. It's called once per starved operation.
+	OnStarvation func(p Priority, waited time.Duration)
+
+	// StarvationThreshold is the maximum time an operation may wait before
+	// OnStarvation is called.
+	StarvationThreshold time.Duration
+
+	// OnLag is an (optional) hook that is called when a tick is processed
+	// more than LagThreshold after it fired. This happens when the main tick
+	// loop is blocked, e.g. by slow operations when no workers are used, in
+	// which case the following operations are executed in a burst.
+	OnLag func(lag time.Duration)
+
+	// LagThreshold is the lag after which OnLag is called. If this is 0, the
+	// interval between two ticks is used.
+	LagThreshold time.Duration
+
+	// OnStop is an (optional) hook that is called exactly once at the end of
+	// Stop, after the ticker has stopped and the workers have finished the
+	// operations that were forwarded to them.
+	OnStop func()
+
 	// PriorityAutoInit sets whether priorities are automatically initialized.
 	// When this is false, the Scheduler will return an error every time an
 	// operation uses an uninitialized priority.
 	PriorityAutoInit bool
 
+	// DefaultPriority is an (optional) catch-all priority. When it is set,
+	// operations that use an uninitialized priority are added to this
+	// priority instead of returning ErrInvalidPriority. It only applies when
+	// PriorityAutoInit is false and must be initialized itself. Methods
+	// that configure or inspect a priority, such as PausePriority, still
+	// return ErrInvalidPriority for an uninitialized priority.
+	DefaultPriority *Priority
+
+	// PrioritySet is an (optional) set of declared priorities. When it's set,
+	// operations using a priority outside of the set are rejected with
+	// ErrInvalidPriority, even when PriorityAutoInit or DefaultPriority would
+	// otherwise accept them.
+	PrioritySet *PrioritySet
+
+	// PriorityMapper is an (optional) function that maps every priority
+	// passed to the Scheduler onto another priority, e.g. to remap legacy
+	// priority numbers onto a new scheme. It's applied by Add, InitPriority
+	// and the other methods that take a priority. When it's nil, priorities
+	// are used as-is.
+	PriorityMapper func(Priority) Priority
+
 	// PriorityDefaultCapacity indicates the default capacity of a priority.
 	// This is only relevant when PriorityAutoInit is true.
 	PriorityDefaultCapacity int
+
+	// OnRateChange is an (optional) hook that is called every time the rate
+	// of the scheduler changes, e.g. by SetRate, BoostRate or the warm-up.
+	// It's called while the scheduler is locked and must not call back into
+	// the Scheduler.
+	OnRateChange func(old, new float32)
+
+	// OnPriorityInit is an (optional) hook that is called every time a new
+	// priority is created. The auto argument is true when the priority was
+	// created by PriorityAutoInit and false when it was created by
+	// InitPriority. It's called while the scheduler is locked and must not
+	// call back into the Scheduler.
+	OnPriorityInit func(p Priority, auto bool)
 }
 
 func (c Config) rate() float32 {
@@ -46,11 +341,21 @@ func (c Config) rate() float32 {
 	return c.OPS
 }
 
+// interval returns the time between two ticks.
+// The rate is converted to float64 through its shortest decimal
+// representation, so that e.g. 0.1 OPS yields exactly 10 seconds instead of
+// suffering from float32 precision loss.
+func (c Config) interval() time.Duration {
+	return interval(c.rate())
+}
+
+func interval(rate float32) time.Duration {
+	r, _ := strconv.ParseFloat(strconv.FormatFloat(float64(rate), 'g', -1, 32), 64)
+	return time.Duration(math.Round(float64(time.Second) / r))
+}
+
 func (c Config) maxops() uint32 {
-	if c.MaxQueueSize <= 0 {
-		return ^uint32(0)
-	}
-	return uint32(c.MaxQueueSize)
+	return getMaxops(c.MaxQueueSize)
 }
 
 func (c Config) opbuf() int {
@@ -59,3 +364,13 @@ func (c Config) opbuf() int {
 	}
 	return c.ExecutionBufferSize
 }
+
+func (c Config) workers() int {
+	if c.Workers <= 0 {
+		return 0
+	}
+	if c.Workers > MaxWorkers {
+		return MaxWorkers
+	}
+	return c.Workers
+}
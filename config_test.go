@@ -1,6 +1,9 @@
 package scheduler
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestConfigMaxops(t *testing.T) {
 	cfg := Config{}
@@ -21,3 +24,37 @@ func TestConfigMaxops(t *testing.T) {
 		t.Fatal("wrong rate")
 	}
 }
+
+func TestConfigWorkers(t *testing.T) {
+	cfg := Config{Workers: -5}
+	if cfg.workers() != 0 {
+		t.Fatal("negative workers should be treated as 0")
+	}
+	cfg.Workers = 10
+	if cfg.workers() != 10 {
+		t.Fatal("wrong workers")
+	}
+	cfg.Workers = 100000
+	if cfg.workers() != MaxWorkers {
+		t.Fatal("workers should be capped to MaxWorkers")
+	}
+}
+
+func TestConfigInterval(t *testing.T) {
+	tests := []struct {
+		ops      float32
+		interval time.Duration
+	}{
+		{0, time.Second},
+		{0.1, 10 * time.Second},
+		{0.25, 4 * time.Second},
+		{0.333, 3003003003},
+		{3, 333333333},
+		{10000, 100 * time.Microsecond},
+	}
+	for _, tt := range tests {
+		if i := (Config{OPS: tt.ops}).interval(); i != tt.interval {
+			t.Fatal("wrong interval for", tt.ops, "OPS:", i)
+		}
+	}
+}
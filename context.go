@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+)
+
+// priorityKey is the context key under which a Priority is stored.
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx that carries the specified priority.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority stored inside ctx.
+// The returned bool is false when ctx carries no priority.
+func PriorityFromContext(ctx context.Context) (Priority, bool) {
+	p, ok := ctx.Value(priorityKey{}).(Priority)
+	return p, ok
+}
+
+// AddCtxPriority adds a new operation using the priority stored inside ctx.
+// When ctx carries no priority, the configured DefaultPriority is used, or
+// priority 0 when no default priority is configured.
+func (s *Scheduler) AddCtxPriority(ctx context.Context, o Operation) error {
+	p, ok := PriorityFromContext(ctx)
+	if !ok && s.dp != nil {
+		p = *s.dp
+	}
+	return s.Add(p, o)
+}
+
+// ContextOperation is an operation that can be cancelled through a context.
+// It can be given a deadline using WithTimeout.
+type ContextOperation interface {
+	ExecuteContext(ctx context.Context)
+}
+
+// ClosureCtx turns a closure into an operation that also implements the
+// ContextOperation interface. Execute passes it a background context.
+func ClosureCtx(fx func(ctx context.Context)) Operation {
+	return contextClosure(fx)
+}
+
+type contextClosure func(ctx context.Context)
+
+func (f contextClosure) Execute() {
+	f(context.Background())
+}
+
+func (f contextClosure) ExecuteContext(ctx context.Context) {
+	f(ctx)
+}
+
+// WithTimeout wraps o so it's executed with a context that's cancelled d
+// after the execution started. Operations that don't implement the
+// ContextOperation interface can't observe the deadline and are executed
+// as they are. The scheduler still sees the Tagged, Sized and Prioritized
+// interfaces of o through the wrapper, but an o that also implements
+// MetaOperation is executed through ExecuteContext instead of ExecuteMeta.
+func WithTimeout(d time.Duration, o Operation) Operation {
+	if _, ok := o.(ContextOperation); !ok {
+		return o
+	}
+	return &timeoutOperation{o: o, d: d}
+}
+
+// timeoutOperation executes a ContextOperation with a timeout.
+type timeoutOperation struct {
+	o Operation
+	d time.Duration
+}
+
+func (t *timeoutOperation) Execute() {
+	ctx, cancel := context.WithTimeout(context.Background(), t.d)
+	defer cancel()
+	t.o.(ContextOperation).ExecuteContext(ctx)
+}
+
+func (t *timeoutOperation) unwrap() interface{} {
+	return t.o
+}
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPriorityFromContext(t *testing.T) {
+	if _, ok := PriorityFromContext(context.Background()); ok {
+		t.Fatal("background context should carry no priority")
+	}
+	ctx := WithPriority(context.Background(), 7)
+	if p, ok := PriorityFromContext(ctx); !ok || p != 7 {
+		t.Fatal("wrong priority", p)
+	}
+}
+
+func TestScheduler_AddCtxPriority(t *testing.T) {
+	o := &testOp{}
+	dp := Priority(2)
+	rl := New(Config{DefaultPriority: &dp})
+	rl.InitPriority(2, 0)
+	rl.InitPriority(5, 0)
+
+	if err := rl.AddCtxPriority(WithPriority(context.Background(), 5), o); err != nil {
+		t.Fatal(err)
+	}
+	if len(rl.PendingPriority(5)) != 1 {
+		t.Fatal("operation should use the context priority")
+	}
+
+	if err := rl.AddCtxPriority(context.Background(), o); err != nil {
+		t.Fatal(err)
+	}
+	if len(rl.PendingPriority(2)) != 1 {
+		t.Fatal("operation should use the default priority")
+	}
+
+	rl = New(Config{})
+	if err := rl.AddCtxPriority(context.Background(), o); err != ErrInvalidPriority {
+		t.Fatal("expected ErrInvalidPriority, got", err)
+	}
+	rl.InitPriority(0, 0)
+	if err := rl.AddCtxPriority(context.Background(), o); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	var err error
+	start := time.Now()
+	WithTimeout(20*time.Millisecond, ClosureCtx(func(ctx context.Context) {
+		<-ctx.Done()
+		err = ctx.Err()
+	})).Execute()
+	if err != context.DeadlineExceeded {
+		t.Fatal("the context should be cancelled at the timeout", err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond || d > time.Second {
+		t.Fatal("the context was cancelled at the wrong moment", d)
+	}
+
+	o := &testOp{}
+	if WithTimeout(time.Second, o) != Operation(o) {
+		t.Fatal("operations without a context should be returned as they are")
+	}
+}
+
+type prioritizedCtxOp struct {
+	taggedOp
+	p Priority
+}
+
+func (o *prioritizedCtxOp) Priority() Priority { return o.p }
+
+func (o *prioritizedCtxOp) ExecuteContext(ctx context.Context) { o.Execute() }
+
+func TestWithTimeoutWrapped(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(0, 0)
+	rl.InitPriority(2, 0)
+
+	rl.AddAuto(WithTimeout(time.Second, &prioritizedCtxOp{taggedOp{tag: "ctx"}, 2}))
+	if len(rl.PendingPriority(2)) != 1 {
+		t.Fatal("the operation should be added at its own priority")
+	}
+	rl.tick(time.Now())
+	if st := rl.Stats(); st.Tags["ctx"] != 1 {
+		t.Fatal("the operation should be counted under its tag", st.Tags)
+	}
+}
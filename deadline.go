@@ -0,0 +1,39 @@
+package scheduler
+
+import "time"
+
+// AddDeadline adds a new operation that is dropped when it hasn't been
+// dispatched within d after it became eligible for dispatch, for example
+// because it's starved by operations of a higher priority.
+//
+// The deadline is evaluated when the next operation is selected, so an
+// operation that is dispatched in time always executes, even when it waits
+// in the execution buffer afterwards. Operations are eligible for dispatch
+// as soon as they are added.
+func (s *Scheduler) AddDeadline(p Priority, o Operation, d time.Duration) error {
+	return s.add(p, queuedOp{op: o, deadline: d}, false)
+}
+
+// expire removes and returns the operations that have passed their
+// dispatch deadline. The caller must hold the lock.
+func (s *Scheduler) expire(now time.Time) []queuedOp {
+	var expired []queuedOp
+	remaining := 0
+	for _, pm := range s.opl {
+		pm.removeFunc(func(q queuedOp) bool {
+			if q.deadline <= 0 {
+				return false
+			}
+			if now.Sub(q.enqueued) > q.deadline {
+				expired = append(expired, q)
+				return true
+			}
+			remaining++
+			return false
+		})
+	}
+	s.curops -= uint32(len(expired))
+	s.freeSpace()
+	s.deadlines = remaining
+	return expired
+}
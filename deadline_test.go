@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerAddDeadline(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	executed := false
+	rl.AddDeadline(1, Closure(func() { executed = true }), 20*time.Millisecond)
+	rl.Add(2, &testOp{})
+	rl.Add(2, &testOp{})
+
+	// The operation is eligible, but starved by the higher priority.
+	rl.tick(time.Now())
+	time.Sleep(30 * time.Millisecond)
+	rl.tick(time.Now())
+	if rl.curops != 0 {
+		t.Fatal("the starved operation should be dropped", rl.curops)
+	}
+	rl.tick(time.Now())
+	if executed {
+		t.Fatal("operation executed after its dispatch deadline")
+	}
+
+	// An operation that is dispatched in time executes.
+	rl.AddDeadline(1, Closure(func() { executed = true }), time.Second)
+	rl.tick(time.Now())
+	if !executed {
+		t.Fatal("operation not executed within its dispatch deadline")
+	}
+	if rl.deadlines != 0 {
+		t.Fatal("deadline count not updated", rl.deadlines)
+	}
+}
+
+func TestSchedulerAddDeadlineRemoved(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	o := &testOp{}
+	rl.AddDeadline(1, o, time.Second)
+	rl.Add(1, &testOp{})
+	if n := rl.RemoveFunc(func(op Operation) bool { return op == o }); n != 1 {
+		t.Fatal("wrong amount of removed operations", n)
+	}
+	if rl.deadlines != 0 {
+		t.Fatal("removing an operation should release its deadline", rl.deadlines)
+	}
+}
@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+)
+
+// Drain blocks until every pending operation has been dispatched, or until
+// the context is done in which case the error of the context is returned.
+// While Drain is running, adding operations fails with ErrDraining. This
+// includes operations that add themselves again, such as operations that
+// were added using AddErr and request to be requeued.
+func (s *Scheduler) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.draining--
+		s.mu.Unlock()
+	}()
+
+	for range s.DrainProgress(ctx) {
+	}
+	return ctx.Err()
+}
+
+// DrainProgress reports the amount of pending operations while the queue
+// drains. The count is sent when it has changed, it's checked once per
+// interval of the rate. The channel is closed when the queue is empty or
+// when the context is done.
+func (s *Scheduler) DrainProgress(ctx context.Context) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		last := -1
+		for {
+			s.mu.Lock()
+			n := int(s.curops)
+			d := s.interval
+			s.mu.Unlock()
+
+			if n != last {
+				select {
+				case ch <- n:
+				case <-ctx.Done():
+					return
+				}
+				last = n
+			}
+			if n == 0 {
+				return
+			}
+
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+		}
+	}()
+	return ch
+}
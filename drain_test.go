@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerDrainProgress(t *testing.T) {
+	rl := New(Config{OPS: 100})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	for i := 0; i < 10; i++ {
+		rl.Add(1, &testOp{})
+	}
+
+	var counts []int
+	for n := range rl.DrainProgress(context.Background()) {
+		counts = append(counts, n)
+	}
+	if len(counts) < 2 || counts[len(counts)-1] != 0 {
+		t.Fatal("progress should count down to zero", counts)
+	}
+	for i := 1; i < len(counts); i++ {
+		if counts[i] >= counts[i-1] {
+			t.Fatal("progress should decrease", counts)
+		}
+	}
+}
+
+func TestSchedulerDrainCancel(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.Add(1, &testOp{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := rl.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatal("drain should return the context error", err)
+	}
+}
+
+func TestSchedulerAddDuringDrain(t *testing.T) {
+	rl := New(Config{OPS: 200, PriorityAutoInit: true})
+	for i := 0; i < 10; i++ {
+		rl.Add(1, &testOp{})
+	}
+
+	done := make(chan error)
+	go func() { done <- rl.Drain(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	if err := rl.Add(1, &testOp{}); err != ErrDraining {
+		t.Fatal("Add during Drain should fail with ErrDraining", err)
+	}
+
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func() { errs <- rl.Add(1, &testOp{}) }()
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-errs; err != nil && err != ErrDraining {
+			t.Fatal("concurrent Add should fail with ErrDraining", err)
+		}
+	}
+
+	rl.Stop()
+	if err := rl.Add(1, &testOp{}); err != ErrStopped {
+		t.Fatal("Add after Stop should fail with ErrStopped", err)
+	}
+}
@@ -0,0 +1,73 @@
+package scheduler
+
+// DropReason indicates why an operation was dropped.
+type DropReason int
+
+// These are the reasons an operation can be dropped for.
+const (
+	// DropCapacity means the operation was rejected because the queue or the
+	// queue of its priority was full.
+	DropCapacity DropReason = iota
+
+	// DropExpired means the operation wasn't dispatched before its dispatch
+	// deadline passed.
+	DropExpired
+
+	// DropRemoved means the operation was removed using RemoveFunc.
+	DropRemoved
+
+	// DropOverflow means the operation exceeded the capacity and was
+	// rejected by the overflow scheduler as well.
+	DropOverflow
+
+	// DropStopped means the operation was still pending when the scheduler
+	// was stopped without a DrainHandler.
+	DropStopped
+
+	// DropCancelled means the predicate of the operation, as passed to AddIf,
+	// returned false right before it would have been dispatched.
+	DropCancelled
+)
+
+// String returns the name of the reason.
+func (r DropReason) String() string {
+	switch r {
+	case DropCapacity:
+		return "capacity"
+	case DropExpired:
+		return "expired"
+	case DropRemoved:
+		return "removed"
+	case DropOverflow:
+		return "overflow"
+	case DropStopped:
+		return "stopped"
+	case DropCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// DropError is passed to the callback of an operation that was added using
+// AddWithCallback or AddErrWithCallback when the operation is dropped.
+type DropError struct {
+	Reason DropReason
+	ID     OpID // The ID of the operation, 0 when it was never queued.
+}
+
+func (e *DropError) Error() string {
+	return "Scheduler: Operation Dropped: " + e.Reason.String()
+}
+
+// drop passes dropped operations to the OnDrop hook and to their callback.
+// It must be called without holding the lock.
+func (s *Scheduler) drop(qs []queuedOp, r DropReason) {
+	for _, q := range qs {
+		if f, ok := q.op.(finisher); ok {
+			f.finish(&DropError{Reason: r, ID: q.id})
+		}
+		if s.onDrop != nil {
+			s.onDrop(q.op, r, q.id)
+		}
+	}
+}
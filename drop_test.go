@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerOnDrop(t *testing.T) {
+	dropped := make(map[DropReason]int)
+	onDrop := func(o Operation, r DropReason, _ OpID) { dropped[r]++ }
+
+	overflow := newManual(Config{MaxQueueSize: 1, PriorityAutoInit: true})
+	defer overflow.Stop()
+	rl := newManual(Config{MaxQueueSize: 2, PriorityAutoInit: true, OnDrop: onDrop})
+	rl.InitPriority(2, 1)
+
+	// Capacity of the priority.
+	rl.Add(2, &testOp{})
+	rl.Add(2, &testOp{})
+	// Removal.
+	rl.Add(1, &testOp{T: 1})
+	rl.RemoveFunc(func(o Operation) bool { return o.(*testOp).T == 1 })
+	// Expiry.
+	rl.AddDeadline(1, &testOp{}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	rl.tick(time.Now())
+	// Capacity of the scheduler.
+	rl.Add(1, &testOp{})
+	rl.Add(1, &testOp{})
+	rl.Add(1, &testOp{})
+	// Overflow.
+	rl.overflow = overflow
+	rl.Add(1, &testOp{})
+	rl.Add(1, &testOp{})
+	// Stop.
+	rl.Stop()
+
+	want := map[DropReason]int{
+		DropCapacity: 2,
+		DropRemoved:  1,
+		DropExpired:  1,
+		DropOverflow: 1,
+		DropStopped:  2,
+	}
+	for r, n := range want {
+		if dropped[r] != n {
+			t.Fatal("wrong amount of drops for", r, dropped[r])
+		}
+	}
+}
+
+func TestSchedulerDropID(t *testing.T) {
+	var ids []OpID
+	rl := newManual(Config{OnDrop: func(_ Operation, _ DropReason, id OpID) { ids = append(ids, id) }})
+	rl.InitPriority(1, 0)
+
+	id, _ := rl.AddID(1, &testOp{})
+	var de *DropError
+	rl.AddWithCallback(1, &testOp{}, func(err error) { de = err.(*DropError) })
+	rl.Stop()
+	if len(ids) != 2 || ids[0] != id || de == nil || de.ID != ids[1] || de.ID == 0 {
+		t.Fatal("dropped operations should report their ID", id, ids, de)
+	}
+}
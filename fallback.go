@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// FallbackBreaker is a circuit breaker around a fallback that can fail.
+// After Threshold consecutive errors, the fallback isn't called for the
+// duration of Cooldown, after which it's called again.
+type FallbackBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// fallbackState tracks the failures of the fallback. It's only used from
+// within the main tick loop.
+type fallbackState struct {
+	fails      int       // Consecutive failures of the fallback.
+	suppressed time.Time // The fallback isn't called until this moment.
+}
+
+// runFallback executes the fallback, if any. An asynchronous fallback is
+// dispatched to the workers instead, unless its previous run is still busy.
+func (s *Scheduler) runFallback() {
+	if s.fallback == nil && s.fallbackErr == nil {
+		return
+	}
+	if !s.asyncFallback || !s.usingWorkers {
+		s.execFallback()
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&s.fbRunning, 0, 1) {
+		return
+	}
+	s.dispatch(Closure(func() {
+		defer atomic.StoreInt32(&s.fbRunning, 0)
+		s.execFallback()
+	}), 0)
+}
+
+// execFallback executes the fallback, if any. It's never called by two
+// goroutines at once.
+func (s *Scheduler) execFallback() {
+	if s.fallback != nil {
+		atomic.AddUint64(&s.fallbackRuns, 1)
+		s.fallback.Execute()
+		return
+	}
+	if s.fallbackErr == nil {
+		return
+	}
+
+	now := time.Now()
+	if now.Before(s.fbState.suppressed) {
+		return
+	}
+	atomic.AddUint64(&s.fallbackRuns, 1)
+	err := s.fallbackErr.Execute()
+	if err == nil {
+		s.fbState.fails = 0
+		return
+	}
+	s.handleError(err, 0)
+	s.fbState.fails++
+	if b := s.fbBreaker; b != nil && s.fbState.fails >= b.Threshold {
+		s.fbState.fails = 0
+		s.fbState.suppressed = now.Add(b.Cooldown)
+	}
+}
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerFallbackBreaker(t *testing.T) {
+	calls := 0
+	errs := 0
+	rl := newManual(Config{
+		FallbackErr: ClosureErr(func() error {
+			calls++
+			return errors.New("refill failed")
+		}),
+		FallbackBreaker: &FallbackBreaker{Threshold: 3, Cooldown: 50 * time.Millisecond},
+		OnError:         func(error, OpID) { errs++ },
+	})
+	defer rl.Stop()
+
+	for i := 0; i < 10; i++ {
+		rl.tick(time.Now())
+	}
+	if calls != 3 || errs != 3 {
+		t.Fatal("fallback should be suppressed after 3 failures", calls, errs)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	rl.tick(time.Now())
+	if calls != 4 {
+		t.Fatal("fallback should be called after the cooldown", calls)
+	}
+}
+
+func TestSchedulerFallbackDuringPause(t *testing.T) {
+	fallbacks := 0
+	rl := newManual(Config{
+		Fallback:            Closure(func() { fallbacks++ }),
+		FallbackDuringPause: true,
+	})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	executed := false
+	rl.Add(1, Closure(func() { executed = true }))
+
+	rl.Pause(time.Minute)
+	rl.tick(time.Now())
+	rl.tick(time.Now())
+	if fallbacks != 2 {
+		t.Fatal("fallback should run during the pause", fallbacks)
+	}
+	if executed {
+		t.Fatal("operations must not be dispatched during the pause")
+	}
+}
+
+func TestSchedulerAsyncFallback(t *testing.T) {
+	var ticks, running, overlaps int32
+	rl := New(Config{
+		OPS:     100,
+		Workers: 2,
+		Fallback: Closure(func() {
+			if atomic.AddInt32(&running, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			time.Sleep(100 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}),
+		AsyncFallback: true,
+		OnTick:        func(bool) { atomic.AddInt32(&ticks, 1) },
+	})
+	time.Sleep(200 * time.Millisecond)
+	rl.Stop()
+
+	if n := atomic.LoadInt32(&ticks); n < 10 {
+		t.Fatal("a slow fallback must not delay the ticks", n)
+	}
+	if atomic.LoadInt32(&overlaps) != 0 {
+		t.Fatal("only a single fallback should run at a time")
+	}
+}
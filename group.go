@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"math"
+	"time"
+)
+
+// rateGroup is a token bucket that limits the rate of the operations that
+// belong to a group. It holds at most a single token, so it doesn't allow
+// any bursts.
+type rateGroup struct {
+	rate   float64   // Tokens per second.
+	tokens float64   // Available tokens.
+	last   time.Time // Last time the tokens were refilled.
+}
+
+// refill adds the tokens that became available since the last refill.
+func (g *rateGroup) refill(now time.Time) {
+	g.tokens = math.Min(1, g.tokens+now.Sub(g.last).Seconds()*g.rate)
+	g.last = now
+}
+
+// SetGroupRate limits the operations of group g to the specified amount of
+// operations per second. This limit applies on top of the rate of the
+// scheduler, which acts as a shared ceiling for all groups together.
+// A rate of 0 or less removes the limit of the group.
+func (s *Scheduler) SetGroupRate(g string, ops float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ops <= 0 {
+		delete(s.groups, g)
+		return
+	}
+	if s.groups == nil {
+		s.groups = make(map[string]*rateGroup)
+	}
+	if rg, ok := s.groups[g]; ok {
+		rg.refill(time.Now())
+		rg.rate = float64(ops)
+		return
+	}
+	s.groups[g] = &rateGroup{rate: float64(ops), tokens: 1, last: time.Now()}
+}
+
+// AddGroup adds a new operation that belongs to group g to the scheduler.
+// When the group is rate limited, its operations are skipped in favor of
+// other operations while the group has exhausted its rate.
+func (s *Scheduler) AddGroup(g string, p Priority, o Operation) error {
+	return s.add(p, queuedOp{op: o, group: g}, false)
+}
+
+// refillGroups refills the budget of every group.
+// The caller must hold the lock.
+func (s *Scheduler) refillGroups(now time.Time) {
+	for _, rg := range s.groups {
+		rg.refill(now)
+	}
+}
+
+// eligible returns the index of the next operation of the priority that
+// may be dispatched, which is the first one unless a Less function orders
+// the operations. Operations of rate limited groups are only eligible
+// when their group has budget left, and paused priorities have no eligible
+// operations. The caller must hold the lock.
+func (s *Scheduler) eligible(pm *priorityMetadata) (int, bool) {
+	if !pm.pause.IsZero() && time.Now().Before(pm.pause) {
+		return 0, false
+	}
+	if len(s.groups) == 0 && s.less == nil {
+		return 0, pm.curops > 0
+	}
+	best, ok := 0, false
+	for i := 0; i < int(pm.curops); i++ {
+		if rg, limited := s.groups[pm.at(i).group]; limited && rg.tokens < 1 {
+			continue
+		}
+		if s.less == nil {
+			return i, true
+		}
+		if !ok || s.less(pm.at(i).export(), pm.at(best).export()) {
+			best, ok = i, true
+		}
+	}
+	return best, ok
+}
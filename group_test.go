@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerGroupRate(t *testing.T) {
+	rl := New(Config{OPS: 4})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.SetGroupRate("a", 3)
+	rl.SetGroupRate("b", 3)
+
+	var a, b int32
+	for i := 0; i < 20; i++ {
+		rl.AddGroup("a", 1, Closure(func() { atomic.AddInt32(&a, 1) }))
+	}
+
+	// Only group a has work, so it's capped by its own rate.
+	time.Sleep(time.Second)
+	if n := atomic.LoadInt32(&a); n < 2 || n > 4 {
+		t.Fatal("group a should be capped at 3/s, executed", n)
+	}
+
+	for i := 0; i < 20; i++ {
+		rl.AddGroup("b", 1, Closure(func() { atomic.AddInt32(&b, 1) }))
+	}
+	before := atomic.LoadInt32(&a)
+
+	// Both groups have work, so together they're capped by the global rate.
+	time.Sleep(2 * time.Second)
+	na, nb := atomic.LoadInt32(&a)-before, atomic.LoadInt32(&b)
+	if na+nb < 7 || na+nb > 9 {
+		t.Fatal("groups should share the global 4/s, executed", na+nb)
+	}
+	if na > 7 || nb > 7 {
+		t.Fatal("groups should be capped at 3/s, executed", na, nb)
+	}
+}
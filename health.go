@@ -0,0 +1,190 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// Status describes the state of a Scheduler.
+type Status string
+
+// These are the possible states of a Scheduler.
+const (
+	StatusRunning Status = "running"
+	StatusPaused  Status = "paused"
+	StatusStopped Status = "stopped"
+)
+
+// Health is a snapshot of the state of a Scheduler.
+type Health struct {
+	Status     Status    `json:"status"`
+	Rate       float32   `json:"rate"`
+	QueueDepth int       `json:"queue_depth"`
+	Workers    int       `json:"workers"`
+	LastTick   time.Time `json:"last_tick"`
+}
+
+// Health returns a snapshot of the state of the scheduler.
+// The snapshot is taken under a single lock acquisition.
+func (s *Scheduler) Health() Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health()
+}
+
+// health returns a snapshot of the state of the scheduler.
+// The caller must hold the lock.
+func (s *Scheduler) health() Health {
+	status := StatusRunning
+	if s.stopped {
+		status = StatusStopped
+	} else if time.Now().Before(s.pause) {
+		status = StatusPaused
+	}
+
+	return Health{
+		Status:     status,
+		Rate:       s.rate,
+		QueueDepth: int(s.curops),
+		Workers:    s.workers,
+		LastTick:   s.lastTick,
+	}
+}
+
+// TimeUntilCapacity estimates how long it takes until the queue has room
+// for at least one more operation, assuming that no operations are added in
+// the meantime. Every tick frees a single slot, so this is based on the
+// current queue depth, the rate and the remainder of an active pause.
+// It returns 0 when there's already capacity.
+func (s *Scheduler) TimeUntilCapacity() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.curops < s.maxops {
+		return 0
+	}
+
+	d := time.Duration(s.curops-s.maxops+1) * s.interval
+	if pause := time.Until(s.pause); pause > 0 {
+		d += pause
+	}
+	return d
+}
+
+// ETA estimates how long it takes until every pending operation has been
+// dispatched at the current rate, including the remainder of an active
+// pause, assuming that no operations are added in the meantime.
+func (s *Scheduler) ETA() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := time.Duration(s.curops) * s.interval
+	if pause := time.Until(s.pause); pause > 0 && s.curops > 0 {
+		d += pause
+	}
+	return d
+}
+
+// TicksProcessed returns the amount of ticks the scheduler has processed,
+// including paused and idle ticks. Compared to the elapsed time, this shows
+// whether the scheduler keeps up with its configured rate.
+func (s *Scheduler) TicksProcessed() uint64 {
+	return atomic.LoadUint64(&s.ticks)
+}
+
+// WillRunFallback reports whether the next tick would run the fallback
+// because the queue is empty. It doesn't take pauses and the rate of groups
+// into account.
+func (s *Scheduler) WillRunFallback() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.curops == 0
+}
+
+// PeakDepth returns the highest amount of pending operations since the
+// scheduler was created, or since the last call to ResetPeak.
+func (s *Scheduler) PeakDepth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int(s.peak)
+}
+
+// ResetPeak resets the peak depth to the current amount of pending
+// operations.
+func (s *Scheduler) ResetPeak() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peak = s.curops
+}
+
+// InFlight returns the amount of operations that have been dispatched to
+// the workers but haven't finished executing yet, including the operations
+// that wait inside the execution buffer. It's always 0 when no workers are
+// used.
+func (s *Scheduler) InFlight() int {
+	return int(atomic.LoadInt64(&s.inFlight))
+}
+
+// OldestAge returns how long the oldest pending operation across all
+// priorities has been waiting, or 0 when the queue is empty.
+func (s *Scheduler) OldestAge() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var oldest time.Time
+	for _, pm := range s.opl {
+		for i := 0; i < int(pm.curops); i++ {
+			if e := pm.at(i).enqueued; oldest.IsZero() || e.Before(oldest) {
+				oldest = e
+			}
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
+
+// PriorityState is a snapshot of the state of a single priority.
+type PriorityState struct {
+	Priority Priority `json:"priority"`
+	Depth    int      `json:"depth"`
+	Capacity int      `json:"capacity"` // 0 when the priority has no limit.
+	Paused   bool     `json:"paused"`
+}
+
+// state is the snapshot serialized by Dump.
+type state struct {
+	Health
+	InFlight   int             `json:"in_flight"`
+	Priorities []PriorityState `json:"priorities"`
+	Stats      Stats           `json:"stats"`
+}
+
+// Dump serializes a snapshot of the entire state of the scheduler as JSON,
+// e.g. for a debug endpoint. It contains the Health, the amount of
+// operations in flight, the depth and capacity of every priority in
+// dispatch order and the Stats. The operations themselves aren't included.
+// The snapshot is taken under a single lock acquisition.
+func (s *Scheduler) Dump() ([]byte, error) {
+	s.mu.Lock()
+	st := state{
+		Health:     s.health(),
+		InFlight:   s.InFlight(),
+		Priorities: make([]PriorityState, len(s.opl)),
+		Stats:      s.stats(),
+	}
+	now := time.Now()
+	for i, pm := range s.opl {
+		ps := PriorityState{
+			Priority: pm.priority,
+			Depth:    int(pm.curops),
+			Paused:   now.Before(pm.pause),
+		}
+		if pm.maxops != unlimited {
+			ps.Capacity = int(pm.maxops + pm.extra)
+		}
+		// The ordered priority list is dispatched from the back.
+		st.Priorities[len(s.opl)-1-i] = ps
+	}
+	s.mu.Unlock()
+	return json.Marshal(st)
+}
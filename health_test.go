@@ -0,0 +1,205 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestScheduler_Health(t *testing.T) {
+	rl := New(Config{OPS: 50, Workers: 3, MaxQueueSize: 10})
+	rl.InitPriority(1, 0)
+
+	time.Sleep(50 * time.Millisecond)
+	if h := rl.Health(); h.Status != StatusRunning || h.LastTick.IsZero() {
+		t.Fatal("wrong health of a running scheduler", h)
+	}
+
+	rl.Pause(time.Second)
+	for i := 0; i < 4; i++ {
+		rl.Add(1, &testOp{})
+	}
+
+	h := rl.Health()
+	if h.Status != StatusPaused || h.Rate != 50 || h.QueueDepth != 4 || h.Workers != 3 {
+		t.Fatal("wrong health of a paused scheduler", h)
+	}
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["status"] != "paused" || m["queue_depth"] != float64(4) {
+		t.Fatal("wrong JSON layout", string(b))
+	}
+
+	rl.Stop()
+	if h := rl.Health(); h.Status != StatusStopped {
+		t.Fatal("wrong health of a stopped scheduler", h)
+	}
+}
+
+func TestScheduler_TimeUntilCapacity(t *testing.T) {
+	rl := newManual(Config{OPS: 4, MaxQueueSize: 3})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	if d := rl.TimeUntilCapacity(); d != 0 {
+		t.Fatal("expected no wait with capacity left, got", d)
+	}
+	for i := 0; i < 3; i++ {
+		rl.Add(1, &testOp{})
+	}
+	if d := rl.TimeUntilCapacity(); d != 250*time.Millisecond {
+		t.Fatal("expected a single interval, got", d)
+	}
+
+	rl.Pause(time.Second)
+	if d := rl.TimeUntilCapacity(); d <= time.Second || d > 1250*time.Millisecond {
+		t.Fatal("the pause should be included, got", d)
+	}
+}
+
+func TestScheduler_TicksProcessed(t *testing.T) {
+	rl := New(Config{OPS: 10})
+	defer rl.Stop()
+	time.Sleep(time.Second + 50*time.Millisecond)
+	if n := rl.TicksProcessed(); n < 9 || n > 11 {
+		t.Fatal("expected about 10 ticks, got", n)
+	}
+}
+
+func TestSchedulerWillRunFallback(t *testing.T) {
+	rl := newManual(Config{PriorityAutoInit: true})
+	defer rl.Stop()
+	if !rl.WillRunFallback() {
+		t.Fatal("empty scheduler should run the fallback")
+	}
+	rl.Add(1, &testOp{})
+	if rl.WillRunFallback() {
+		t.Fatal("scheduler with queued work shouldn't run the fallback")
+	}
+}
+
+func TestSchedulerETA(t *testing.T) {
+	rl := newManual(Config{OPS: 10, PriorityAutoInit: true})
+	defer rl.Stop()
+	if rl.ETA() != 0 {
+		t.Fatal("empty queue should have no ETA")
+	}
+	for i := 0; i < 20; i++ {
+		rl.Add(1, &testOp{})
+	}
+	if eta := rl.ETA(); eta != 2*time.Second {
+		t.Fatal("wrong ETA", eta)
+	}
+	rl.Pause(time.Minute)
+	if eta := rl.ETA(); eta <= time.Minute+time.Second || eta > time.Minute+2*time.Second {
+		t.Fatal("ETA should include the pause", eta)
+	}
+}
+
+func TestSchedulerPeakDepth(t *testing.T) {
+	rl := newManual(Config{PriorityAutoInit: true})
+	defer rl.Stop()
+	for i := 0; i < 5; i++ {
+		rl.Add(1, &testOp{})
+	}
+	for i := 0; i < 5; i++ {
+		rl.tick(time.Now())
+	}
+	rl.Add(1, &testOp{})
+	if n := rl.PeakDepth(); n != 5 {
+		t.Fatal("peak should reflect the maximum backlog", n)
+	}
+	rl.ResetPeak()
+	if n := rl.PeakDepth(); n != 1 {
+		t.Fatal("reset should set the peak to the current depth", n)
+	}
+}
+
+func TestSchedulerInFlight(t *testing.T) {
+	rl := newManual(Config{Workers: 2, ExecutionBufferSize: 2})
+	rl.InitPriority(1, 0)
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		rl.Add(1, Closure(func() { <-release }))
+		rl.tick(time.Now())
+	}
+	if n := rl.InFlight(); n != 3 {
+		t.Fatal("busy workers should be in flight", n)
+	}
+	close(release)
+	rl.Stop()
+	if n := rl.InFlight(); n != 0 {
+		t.Fatal("nothing should be in flight when idle", n)
+	}
+}
+
+func TestSchedulerOldestAge(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	if rl.OldestAge() != 0 {
+		t.Fatal("an empty queue has no oldest operation")
+	}
+	rl.Add(2, &testOp{})
+	time.Sleep(20 * time.Millisecond)
+	rl.Add(1, &testOp{})
+	age := rl.OldestAge()
+	if age < 20*time.Millisecond {
+		t.Fatal("the age should be the one of the oldest operation", age)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if rl.OldestAge() <= age {
+		t.Fatal("the age should grow while the operation waits")
+	}
+
+	rl.tick(time.Now())
+	if age := rl.OldestAge(); age >= 20*time.Millisecond {
+		t.Fatal("the age should drop once the operation is dispatched", age)
+	}
+	rl.tick(time.Now())
+	if rl.OldestAge() != 0 {
+		t.Fatal("a drained queue has no oldest operation")
+	}
+}
+
+func TestSchedulerDump(t *testing.T) {
+	rl := newManual(Config{OPS: 5, Workers: 2})
+	defer rl.Stop()
+	rl.InitPriority(1, 10)
+	rl.InitPriority(2, 0)
+	rl.Add(1, &testOp{})
+	rl.Add(1, &testOp{})
+	rl.PausePriority(2, time.Minute)
+
+	b, err := rl.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st struct {
+		Status     Status          `json:"status"`
+		Rate       float32         `json:"rate"`
+		Workers    int             `json:"workers"`
+		InFlight   *int            `json:"in_flight"`
+		Priorities []PriorityState `json:"priorities"`
+		Stats      *Stats          `json:"stats"`
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != StatusRunning || st.Rate != 5 || st.Workers != 2 || st.InFlight == nil || st.Stats == nil {
+		t.Fatal("wrong scheduler state", string(b))
+	}
+	want := []PriorityState{{2, 0, 0, true}, {1, 2, 10, false}}
+	if len(st.Priorities) != 2 || st.Priorities[0] != want[0] || st.Priorities[1] != want[1] {
+		t.Fatal("wrong priority state", st.Priorities)
+	}
+}
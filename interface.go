@@ -0,0 +1,15 @@
+package scheduler
+
+import "time"
+
+// SchedulerInterface is the minimal interface of a Scheduler. Code that
+// depends on it instead of *Scheduler can be tested using the MockScheduler
+// of the schedulertest package.
+type SchedulerInterface interface {
+	Add(p Priority, o Operation) error
+	InitPriority(p Priority, maxops int) bool
+	Pause(d time.Duration)
+	Stop()
+}
+
+var _ SchedulerInterface = (*Scheduler)(nil)
@@ -0,0 +1,27 @@
+package scheduler
+
+// Job is a handle to a set of operations that can be cancelled together.
+type Job struct {
+	s  *Scheduler
+	id uint64
+}
+
+// NewJob returns a new Job for the scheduler.
+func (s *Scheduler) NewJob() *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastJob++
+	return &Job{s: s, id: s.lastJob}
+}
+
+// Add adds a new operation that belongs to the job to the scheduler.
+func (j *Job) Add(p Priority, o Operation) error {
+	return j.s.add(p, queuedOp{op: o, job: j.id}, false)
+}
+
+// Cancel removes every pending operation of the job and returns the
+// amount of removed operations. Operations that have already been
+// dispatched aren't affected. The job can still be used afterwards.
+func (j *Job) Cancel() int {
+	return j.s.removeFunc(func(q queuedOp) bool { return q.job == j.id })
+}
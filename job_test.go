@@ -0,0 +1,35 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobCancel(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	a, b := rl.NewJob(), rl.NewJob()
+	var executed []string
+	for i := 0; i < 3; i++ {
+		a.Add(1, Closure(func() { executed = append(executed, "a") }))
+		b.Add(1, Closure(func() { executed = append(executed, "b") }))
+	}
+	rl.Add(1, Closure(func() { executed = append(executed, "none") }))
+
+	if n := a.Cancel(); n != 3 {
+		t.Fatal("every operation of the job should be removed", n)
+	}
+	for i := 0; i < 5; i++ {
+		rl.tick(time.Now())
+	}
+	if len(executed) != 4 {
+		t.Fatal("wrong operations executed", executed)
+	}
+	for _, e := range executed {
+		if e == "a" {
+			t.Fatal("cancelled operations shouldn't execute", executed)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrUnknownScheduler is returned by the MultiScheduler when no scheduler
+// has been registered under the requested name.
+var ErrUnknownScheduler = errors.New("MultiScheduler: Scheduler is not registered")
+
+// MultiScheduler is a thin composition layer over several named schedulers,
+// each of which enforces its own rate limit.
+type MultiScheduler struct {
+	mu sync.Mutex
+	sl map[string]*Scheduler
+}
+
+// NewMulti creates a new MultiScheduler without any schedulers.
+func NewMulti() *MultiScheduler {
+	return &MultiScheduler{
+		sl: make(map[string]*Scheduler),
+	}
+}
+
+// Register creates a new Scheduler using the configuration and registers it
+// under the specified name. An existing scheduler with the same name will be
+// stopped and replaced.
+func (m *MultiScheduler) Register(name string, c Config) *Scheduler {
+	s := New(c)
+	m.mu.Lock()
+	old, ok := m.sl[name]
+	m.sl[name] = s
+	m.mu.Unlock()
+	if ok {
+		old.Stop()
+	}
+	return s
+}
+
+// Scheduler returns the scheduler registered under the specified name.
+func (m *MultiScheduler) Scheduler(name string) (*Scheduler, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sl[name]
+	return s, ok
+}
+
+// Add adds a new operation to the scheduler registered under the specified
+// name. It returns ErrUnknownScheduler when no such scheduler exists.
+func (m *MultiScheduler) Add(name string, p Priority, o Operation) error {
+	s, ok := m.Scheduler(name)
+	if !ok {
+		return ErrUnknownScheduler
+	}
+	return s.Add(p, o)
+}
+
+// Pause pauses all of the registered schedulers for the specified duration.
+func (m *MultiScheduler) Pause(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sl {
+		s.Pause(d)
+	}
+}
+
+// Stop stops all of the registered schedulers.
+// The MultiScheduler shouldn't be used after Stop has been called.
+func (m *MultiScheduler) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sl {
+		s.Stop()
+	}
+}
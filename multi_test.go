@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMultiScheduler(t *testing.T) {
+	m := NewMulti()
+	defer m.Stop()
+
+	if err := m.Add("fast", 1, &testOp{}); err != ErrUnknownScheduler {
+		t.Fatal("expected ErrUnknownScheduler")
+	}
+
+	m.Register("fast", Config{OPS: 20}).InitPriority(1, 0)
+	m.Register("slow", Config{OPS: 4}).InitPriority(1, 0)
+
+	var fast, slow int32
+	for i := 0; i < 50; i++ {
+		if err := m.Add("fast", 1, Closure(func() { atomic.AddInt32(&fast, 1) })); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Add("slow", 1, Closure(func() { atomic.AddInt32(&slow, 1) })); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(time.Second)
+	f, s := atomic.LoadInt32(&fast), atomic.LoadInt32(&slow)
+	if f < 15 || f > 21 {
+		t.Fatal("fast scheduler executed", f, "operations")
+	}
+	if s < 3 || s > 5 {
+		t.Fatal("slow scheduler executed", s, "operations")
+	}
+
+	m.Pause(time.Second)
+	f = atomic.LoadInt32(&fast)
+	time.Sleep(500 * time.Millisecond)
+	if atomic.LoadInt32(&fast) > f+1 {
+		t.Fatal("paused scheduler should not execute operations")
+	}
+}
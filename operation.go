@@ -1,5 +1,10 @@
 package scheduler
 
+import (
+	"fmt"
+	"time"
+)
+
 // Operation is an operation that can be executed by the scheduler.
 type Operation interface {
 	Execute()
@@ -16,3 +21,141 @@ type operationClosure func()
 func (f operationClosure) Execute() {
 	f()
 }
+
+// Prioritized is an operation that declares its own priority.
+// Such operations can be added using AddAuto.
+type Prioritized interface {
+	Priority() Priority
+}
+
+// MetaOperation is an operation that receives metadata about its own
+// scheduling when it's executed. Operations added to the scheduler that also
+// implement MetaOperation are executed through ExecuteMeta instead of Execute.
+type MetaOperation interface {
+	ExecuteMeta(OpMeta)
+}
+
+// OpMeta contains the metadata passed to a MetaOperation.
+type OpMeta struct {
+	ID       OpID          // The ID of the operation, as returned by AddID.
+	Priority Priority      // The priority the operation was queued at.
+	Enqueued time.Time     // The moment the operation was added.
+	Wait     time.Duration // The time between adding and executing the operation.
+}
+
+// metaOperation executes a MetaOperation with its metadata.
+type metaOperation struct {
+	o        MetaOperation
+	id       OpID
+	priority Priority
+	enqueued time.Time
+}
+
+func (m *metaOperation) Execute() {
+	m.o.ExecuteMeta(OpMeta{
+		ID:       m.id,
+		Priority: m.priority,
+		Enqueued: m.enqueued,
+		Wait:     time.Since(m.enqueued),
+	})
+}
+
+// wrapper is implemented by the operations the scheduler wraps around the
+// operations that are added using e.g. AddErr, AddReliable and AddChunked.
+type wrapper interface {
+	unwrap() interface{}
+}
+
+// identifiable is implemented by the wrappers that report errors or add
+// their operation again. They receive the scheduler that dispatches them and
+// the ID of the operation, so they report to and are added again to that
+// scheduler, also after being moved using TakePriority.
+type identifiable interface {
+	identify(s *Scheduler, id OpID)
+}
+
+// unwrap returns the operation that was originally added for o, so its
+// optional interfaces such as Tagged and Sized can be used.
+func unwrap(o interface{}) interface{} {
+	for {
+		w, ok := o.(wrapper)
+		if !ok {
+			return o
+		}
+		o = w.unwrap()
+	}
+}
+
+// added returns the operation that was originally added for o when it's an
+// Operation itself, and o otherwise.
+func added(o Operation) Operation {
+	if u, ok := unwrap(o).(Operation); ok {
+		return u
+	}
+	return o
+}
+
+// ErrorOperation is an operation whose execution can fail.
+// It can be added to the scheduler using AddErr.
+type ErrorOperation interface {
+	Execute() error
+}
+
+// ClosureErr turns a closure into the ErrorOperation interface.
+func ClosureErr(fx func() error) ErrorOperation {
+	return errorClosure(fx)
+}
+
+type errorClosure func() error
+
+func (f errorClosure) Execute() error {
+	return f()
+}
+
+// ChunkedOperation is an operation that does its work in chunks, one chunk
+// per execution. Execute returns whether work remains, in which case the
+// operation is added to the same priority again. It can be added to the
+// scheduler using AddChunked.
+type ChunkedOperation interface {
+	Execute() bool
+}
+
+// ClosureChunked turns a closure into the ChunkedOperation interface.
+func ClosureChunked(fx func() bool) ChunkedOperation {
+	return chunkedClosure(fx)
+}
+
+type chunkedClosure func() bool
+
+func (f chunkedClosure) Execute() bool {
+	return f()
+}
+
+// RequeueError can be returned by an ErrorOperation to signal that it should
+// be executed again instead of being considered done. The scheduler adds the
+// operation to the same priority again once Delay has passed.
+type RequeueError struct {
+	Delay time.Duration
+}
+
+func (e *RequeueError) Error() string {
+	return "Scheduler: Operation Requested To Be Requeued"
+}
+
+// ErrRequeue can be returned by an ErrorOperation to be requeued immediately.
+var ErrRequeue error = &RequeueError{}
+
+// RequeueAfter returns an error that requeues an ErrorOperation after d.
+func RequeueAfter(d time.Duration) error {
+	return &RequeueError{Delay: d}
+}
+
+// PanicError is passed to the OnError hook when an operation that was added
+// using AddReliable keeps panicking after all its retries.
+type PanicError struct {
+	Value interface{} // The value the operation panicked with.
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("Scheduler: Operation Panicked: %v", e.Value)
+}
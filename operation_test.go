@@ -1,6 +1,10 @@
 package scheduler
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+)
 
 type testOp struct{ T int }
 
@@ -17,3 +21,69 @@ func TestOperationClosure(t *testing.T) {
 		t.Fatal("operation failed")
 	}
 }
+
+func TestOperationClosureErr(t *testing.T) {
+	err := errors.New("failed")
+	if ClosureErr(func() error { return err }).Execute() != err {
+		t.Fatal("wrong error")
+	}
+}
+
+func TestRequeueError(t *testing.T) {
+	var re *RequeueError
+	if !errors.As(ErrRequeue, &re) || re.Delay != 0 {
+		t.Fatal("ErrRequeue should be an immediate RequeueError")
+	}
+	if !errors.As(RequeueAfter(time.Second), &re) || re.Delay != time.Second {
+		t.Fatal("wrong RequeueError delay")
+	}
+}
+
+type testMetaOp struct {
+	executed bool
+	meta     chan OpMeta
+}
+
+func (o *testMetaOp) Execute() { o.executed = true }
+
+func (o *testMetaOp) ExecuteMeta(m OpMeta) { o.meta <- m }
+
+func TestMetaOperation(t *testing.T) {
+	rl := New(Config{OPS: 20, Workers: 1})
+	defer rl.Stop()
+	rl.InitPriority(3, 0)
+
+	o := &testMetaOp{meta: make(chan OpMeta, 1)}
+	if err := rl.Add(3, o); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-o.meta:
+		if m.Priority != 3 || m.Enqueued.IsZero() || m.Wait <= 0 {
+			t.Fatal("wrong metadata", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ExecuteMeta should have been called")
+	}
+	if o.executed {
+		t.Fatal("Execute must not be called for a MetaOperation")
+	}
+}
+
+func TestMetaOperationID(t *testing.T) {
+	rl := newManual(Config{PriorityAutoInit: true})
+	defer rl.Stop()
+
+	o := &testMetaOp{meta: make(chan OpMeta, 1)}
+	rl.Add(1, &testOp{})
+	id, err := rl.AddID(1, o)
+	if err != nil || id == 0 {
+		t.Fatal("operation should receive an ID", id, err)
+	}
+	rl.tick(time.Now())
+	rl.tick(time.Now())
+	if m := <-o.meta; m.ID != id {
+		t.Fatal("the ID at execution should match the ID at enqueue", m.ID, id)
+	}
+}
@@ -0,0 +1,30 @@
+package scheduler
+
+// OverflowPolicy is the behavior of a priority when its queue is full.
+type OverflowPolicy int
+
+// These are the available overflow policies.
+const (
+	// OverflowReject rejects new operations with ErrPriorityCapacity.
+	OverflowReject OverflowPolicy = iota
+
+	// OverflowDropOldest drops the oldest pending operation of the priority
+	// to make room for the new operation. The dropped operation is passed to
+	// the OnDrop hook with DropCapacity.
+	OverflowDropOldest
+)
+
+// SetPriorityOverflow sets the behavior of a priority when its queue is
+// full. Every priority rejects new operations by default. The policy only
+// applies to the capacity of the priority, operations beyond the
+// MaxQueueSize are always rejected.
+func (s *Scheduler) SetPriorityOverflow(p Priority, policy OverflowPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pm, err := s.getPriorityMetadata(s.mapPriority(p))
+	if err != nil {
+		return err
+	}
+	pm.overflow = policy
+	return nil
+}
@@ -0,0 +1,37 @@
+package scheduler
+
+import "testing"
+
+func TestSchedulerSetPriorityOverflow(t *testing.T) {
+	var dropped []Operation
+	rl := newManual(Config{OnDrop: func(o Operation, r DropReason, _ OpID) {
+		dropped = append(dropped, o)
+	}})
+	defer rl.Stop()
+	rl.InitPriority(1, 2)
+	rl.InitPriority(2, 2)
+	if err := rl.SetPriorityOverflow(1, OverflowDropOldest); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := rl.Add(1, &testOp{T: i}); err != nil {
+			t.Fatal("background priority should drop the oldest", err)
+		}
+		err := rl.Add(2, &testOp{T: i})
+		if i == 2 && err != ErrPriorityCapacity {
+			t.Fatal("realtime priority should reject", err)
+		}
+	}
+
+	if len(dropped) != 2 || dropped[0].(*testOp).T != 0 || dropped[1].(*testOp).T != 2 {
+		t.Fatal("wrong operations dropped", dropped)
+	}
+	ops := rl.PendingPriority(1)
+	if len(ops) != 2 || ops[0].(*testOp).T != 1 || ops[1].(*testOp).T != 2 {
+		t.Fatal("the oldest operation should be evicted", ops)
+	}
+	if rl.curops != 4 {
+		t.Fatal("wrong amount of operations", rl.curops)
+	}
+}
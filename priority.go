@@ -1,67 +1,233 @@
 package scheduler
 
+import "time"
+
 // Priority indicates a specific priority.
-// The higher the value, the higher the priority.
+// The higher the value, the higher the priority, unless the scheduler is
+// configured with the LowerFirst PriorityOrder.
 type Priority int
 
 // (TODO): Refactor weight to "p"
 
+// queuedOp is an operation inside the queue of a priority.
+type queuedOp struct {
+	op        Operation
+	id        OpID          // The ID of the operation.
+	priority  Priority      // The priority the operation is queued at.
+	enqueued  time.Time     // The moment the operation was added.
+	group     string        // The group the operation belongs to, if any.
+	job       uint64        // The ID of the Job the operation belongs to, if any.
+	shouldRun func() bool   // Decides whether the operation runs, if any.
+	deadline  time.Duration // Maximum time to wait for dispatch, if any.
+}
+
+// QueuedOp describes an operation inside the queue of a priority.
+type QueuedOp struct {
+	Operation Operation
+	ID        OpID      // The ID of the operation.
+	Priority  Priority  // The priority the operation is queued at.
+	Enqueued  time.Time // The moment the operation was added.
+}
+
+// export returns the exported description of q.
+func (q queuedOp) export() QueuedOp {
+	return QueuedOp{Operation: q.op, ID: q.id, Priority: q.priority, Enqueued: q.enqueued}
+}
+
+// operation returns the operation that must be executed for q.
+func (q queuedOp) operation(s *Scheduler) Operation {
+	if io, ok := q.op.(identifiable); ok {
+		io.identify(s, q.id)
+	}
+	if mo, ok := q.op.(MetaOperation); ok {
+		return &metaOperation{o: mo, id: q.id, priority: q.priority, enqueued: q.enqueued}
+	}
+	return q.op
+}
+
 // priorityMetadata stores metadata of a priority inside the Scheduler.
 type priorityMetadata struct {
 	priority Priority
-	oplist   map[int]Operation
+	oplist   []queuedOp // Ring buffer of operations, its length is a power of two.
+	first    int        // Index of the next operation inside oplist.
 
-	maxops uint32 // Maximum amount of operations
-	curops uint32 // Current amount of operations
+	maxops uint32  // Maximum amount of operations
+	extra  uint32  // Temporarily granted extra capacity
+	curops uint32  // Current amount of operations
+	weight float64 // Weight used by weighted random selection
 
-	first int
-	last  int
+	overflow OverflowPolicy // Behavior when the queue is full
+	pause    time.Time      // The time until the priority must pause.
+	history  rateHistory    // Dispatched operations per second.
+	starved  OpID           // The last operation reported as starved.
+	quota    *quota         // Guaranteed dispatches per window, if any.
 
 	Minimum         uint32
-	MinimumCallback func(Priority)
+	MinimumCallback func(Priority, int)
 }
 
+// unlimited is the maximum amount of operations of a queue without limit.
+const unlimited = ^uint32(0)
+
+// getMaxops converts a requested maximum amount of operations into the
+// internal representation. A queue with maximum N holds exactly N operations,
+// a maximum of 0 or less means that no limit is applied.
 func getMaxops(maxops int) uint32 {
-	maxops32 := uint32(maxops)
-	if maxops32 == 0 {
-		maxops32--
+	if maxops <= 0 {
+		return unlimited
 	}
-	return maxops32
+	return uint32(maxops)
 }
 
 func newPriorityMetadata(p Priority, maxops int) *priorityMetadata {
 	return &priorityMetadata{
 		priority: p,
-		oplist:   make(map[int]Operation),
 		curops:   0,
 		maxops:   getMaxops(maxops),
+		weight:   1,
 	}
 }
 
+// full returns whether the priority has reached its capacity, including
+// the temporarily granted extra capacity.
+func (p *priorityMetadata) full() bool {
+	if p.maxops == unlimited {
+		return false
+	}
+	return uint64(p.curops) >= uint64(p.maxops)+uint64(p.extra)
+}
+
 // AddOperation adds a new operation to the priority.
 // It might return ErrPriorityCapacity when the priority-specific queue is full.
 func (p *priorityMetadata) AddOperation(o Operation) error {
-	if p.curops == p.maxops {
+	return p.push(queuedOp{op: o, enqueued: time.Now()})
+}
+
+// GetOperation returns the next operation of this priority.
+// If no operation is available, the returned bool will be false.
+func (p *priorityMetadata) GetOperation() (Operation, bool) {
+	q, ok := p.pop()
+	return q.op, ok
+}
+
+// push adds a queued operation to the back of the priority.
+func (p *priorityMetadata) push(q queuedOp) error {
+	if p.full() {
 		return ErrPriorityCapacity
 	}
+	if int(p.curops) == len(p.oplist) {
+		p.grow()
+	}
+	q.priority = p.priority
+	p.oplist[p.index(int(p.curops))] = q
 	p.curops++
-	p.oplist[p.last] = o
-	p.last++
 	return nil
 }
 
-// GetOperation returns the next operation of this priority.
-// If no operation is available, the returned bool will be false.
-func (p *priorityMetadata) GetOperation() (Operation, bool) {
-	if p.last == p.first {
-		return nil, false
+// pushFront adds a queued operation to the front of the priority, so it
+// becomes the next operation to be dequeued.
+func (p *priorityMetadata) pushFront(q queuedOp) error {
+	if p.full() {
+		return ErrPriorityCapacity
+	}
+	if int(p.curops) == len(p.oplist) {
+		p.grow()
+	}
+	q.priority = p.priority
+	p.first = p.index(len(p.oplist) - 1)
+	p.oplist[p.first] = q
+	p.curops++
+	return nil
+}
+
+// pop removes and returns the queued operation at the front of the priority.
+func (p *priorityMetadata) pop() (queuedOp, bool) {
+	if p.curops == 0 {
+		return queuedOp{}, false
+	}
+	return p.take(0), true
+}
+
+// take removes and returns the i-th pending operation of the priority.
+func (p *priorityMetadata) take(i int) queuedOp {
+	q := p.oplist[p.index(i)]
+	if i == 0 {
+		p.oplist[p.first] = queuedOp{}
+		p.first = p.index(1)
+	} else {
+		// Shift the operations behind i to the front to fill the gap.
+		for j := i; j < int(p.curops)-1; j++ {
+			p.oplist[p.index(j)] = p.oplist[p.index(j+1)]
+		}
+		p.oplist[p.index(int(p.curops)-1)] = queuedOp{}
 	}
-	o := p.oplist[p.first]
-	delete(p.oplist, p.first)
-	p.first++
 	p.curops--
-	if p.curops == p.Minimum && p.MinimumCallback != nil {
-		p.MinimumCallback(p.priority)
+	return q
+}
+
+// minimumCall returns the call of the minimum callback when the priority
+// holds exactly its minimum amount of operations, or nil otherwise. The
+// call must be made without holding the lock of the scheduler, so the
+// callback can refill the queue.
+func (p *priorityMetadata) minimumCall() func() {
+	if p.curops != p.Minimum || p.MinimumCallback == nil {
+		return nil
+	}
+	cb, pr, n := p.MinimumCallback, p.priority, int(p.curops)
+	return func() { cb(pr, n) }
+}
+
+// removeFunc removes all pending operations for which pred returns true,
+// preserving the order of the remaining operations. It returns the amount
+// of removed operations.
+func (p *priorityMetadata) removeFunc(pred func(queuedOp) bool) int {
+	n := int(p.curops)
+	kept := 0
+	for i := 0; i < n; i++ {
+		q := p.at(i)
+		if pred(q) {
+			continue
+		}
+		p.oplist[p.index(kept)] = q
+		kept++
+	}
+	for i := kept; i < n; i++ {
+		p.oplist[p.index(i)] = queuedOp{}
+	}
+	p.curops = uint32(kept)
+	return n - kept
+}
+
+// at returns the i-th pending operation of the priority.
+func (p *priorityMetadata) at(i int) queuedOp {
+	return p.oplist[p.index(i)]
+}
+
+// Operations returns a snapshot of the pending operations in FIFO order.
+func (p *priorityMetadata) Operations() []Operation {
+	ops := make([]Operation, p.curops)
+	for i := range ops {
+		ops[i] = p.oplist[p.index(i)].op
+	}
+	return ops
+}
+
+// index returns the position inside oplist of the i-th pending operation.
+func (p *priorityMetadata) index(i int) int {
+	return (p.first + i) & (len(p.oplist) - 1)
+}
+
+// grow doubles the capacity of the ring buffer while preserving the order
+// of the pending operations.
+func (p *priorityMetadata) grow() {
+	size := 2 * len(p.oplist)
+	if size == 0 {
+		size = 8
+	}
+	oplist := make([]queuedOp, size)
+	for i := 0; i < int(p.curops); i++ {
+		oplist[i] = p.oplist[p.index(i)]
 	}
-	return o, true
+	p.oplist = oplist
+	p.first = 0
 }
@@ -51,3 +51,89 @@ func TestPriorityOperations(t *testing.T) {
 		t.Fatal("should not be ok")
 	}
 }
+
+func TestPriorityOperationsGrow(t *testing.T) {
+	p := newPriorityMetadata(1, 0)
+	next := 0
+	// Interleave adds and removals so the ring buffer wraps before it grows.
+	for i := 0; i < 100; i++ {
+		if err := p.AddOperation(&testOp{i}); err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 0 {
+			op, ok := p.GetOperation()
+			if !ok || op.(*testOp).T != next {
+				t.Fatal("wrong operation order")
+			}
+			next++
+		}
+	}
+	for _, op := range p.Operations() {
+		if op.(*testOp).T != next {
+			t.Fatal("wrong operation order")
+		}
+		next++
+	}
+	if next != 100 {
+		t.Fatal("wrong amount of operations")
+	}
+}
+
+func TestPriorityCapacityBoundary(t *testing.T) {
+	if getMaxops(0) != unlimited || getMaxops(-1) != unlimited {
+		t.Fatal("0 or less should be unlimited")
+	}
+
+	p := newPriorityMetadata(1, 1)
+	if err := p.AddOperation(&testOp{}); err != nil {
+		t.Fatal("a capacity of 1 should hold exactly 1 operation")
+	}
+	if err := p.AddOperation(&testOp{}); err != ErrPriorityCapacity {
+		t.Fatal("a capacity of 1 should reject the second operation")
+	}
+
+	p = newPriorityMetadata(1, 0)
+	for i := 0; i < 1000; i++ {
+		if err := p.AddOperation(&testOp{}); err != nil {
+			t.Fatal("an unlimited priority should accept operations")
+		}
+	}
+}
+
+func TestPriorityPushFront(t *testing.T) {
+	p := newPriorityMetadata(1, 10)
+	for i := 0; i < 8; i++ {
+		p.AddOperation(&testOp{i})
+	}
+	// The ring buffer is full, so this has to grow it.
+	if err := p.pushFront(queuedOp{op: &testOp{-1}}); err != nil {
+		t.Fatal(err)
+	}
+	p.pushFront(queuedOp{op: &testOp{-2}})
+	if err := p.pushFront(queuedOp{op: &testOp{-3}}); err != ErrPriorityCapacity {
+		t.Fatal("expected ErrPriorityCapacity")
+	}
+
+	want := []int{-2, -1, 0, 1, 2, 3, 4, 5, 6, 7}
+	for i, o := range p.Operations() {
+		if o.(*testOp).T != want[i] {
+			t.Fatal("wrong order after pushFront", i)
+		}
+	}
+}
+
+func TestPriorityTake(t *testing.T) {
+	p := newPriorityMetadata(1, 0)
+	for i := 0; i < 5; i++ {
+		p.AddOperation(&testOp{i})
+	}
+	if q := p.take(2); q.op.(*testOp).T != 2 {
+		t.Fatal("wrong operation taken")
+	}
+	want := []int{0, 1, 3, 4}
+	for i, o := range p.Operations() {
+		if o.(*testOp).T != want[i] {
+			t.Fatal("wrong order after take")
+		}
+	}
+}
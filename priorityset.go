@@ -0,0 +1,72 @@
+package scheduler
+
+// PrioritySet is a fixed and ordered set of named priorities.
+// It avoids using bare priority numbers, where a typo could silently create
+// a new priority when PriorityAutoInit is enabled.
+type PrioritySet struct {
+	names  []string
+	byName map[string]Priority
+}
+
+// NewPrioritySet creates a new PrioritySet from names ordered from the lowest
+// to the highest priority. The first name gets priority 0, the second name
+// priority 1 and so on. Duplicate names keep their first priority.
+func NewPrioritySet(names ...string) *PrioritySet {
+	ps := &PrioritySet{
+		names:  make([]string, len(names)),
+		byName: make(map[string]Priority, len(names)),
+	}
+	copy(ps.names, names)
+	for i, name := range names {
+		if _, ok := ps.byName[name]; !ok {
+			ps.byName[name] = Priority(i)
+		}
+	}
+	return ps
+}
+
+// Priority returns the priority with the specified name.
+// The returned bool is false when the name isn't part of the set.
+func (ps *PrioritySet) Priority(name string) (Priority, bool) {
+	p, ok := ps.byName[name]
+	return p, ok
+}
+
+// Name returns the name of a priority of the set, or an empty string when
+// the priority isn't part of the set.
+func (ps *PrioritySet) Name(p Priority) string {
+	if !ps.Contains(p) {
+		return ""
+	}
+	return ps.names[p]
+}
+
+// Priorities returns all priorities of the set from lowest to highest.
+func (ps *PrioritySet) Priorities() []Priority {
+	pl := make([]Priority, len(ps.names))
+	for i := range pl {
+		pl[i] = Priority(i)
+	}
+	return pl
+}
+
+// Contains returns whether the priority is part of the set.
+func (ps *PrioritySet) Contains(p Priority) bool {
+	return p >= 0 && int(p) < len(ps.names)
+}
+
+// Validate returns ErrInvalidPriority when the priority isn't part of the set.
+func (ps *PrioritySet) Validate(p Priority) error {
+	if !ps.Contains(p) {
+		return ErrInvalidPriority
+	}
+	return nil
+}
+
+// Init initializes every priority of the set on the scheduler using the
+// specified maximum amount of operations per priority.
+func (ps *PrioritySet) Init(s *Scheduler, maxops int) {
+	for _, p := range ps.Priorities() {
+		s.InitPriority(p, maxops)
+	}
+}
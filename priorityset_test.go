@@ -0,0 +1,40 @@
+package scheduler
+
+import "testing"
+
+func TestPrioritySet(t *testing.T) {
+	ps := NewPrioritySet("low", "normal", "high")
+	if p, ok := ps.Priority("high"); !ok || p != 2 {
+		t.Fatal("wrong priority", p)
+	}
+	if _, ok := ps.Priority("urgent"); ok {
+		t.Fatal("unknown names should not be found")
+	}
+	if ps.Name(1) != "normal" || ps.Name(3) != "" || ps.Name(-1) != "" {
+		t.Fatal("wrong names")
+	}
+	if pl := ps.Priorities(); len(pl) != 3 || pl[0] != 0 || pl[2] != 2 {
+		t.Fatal("wrong priorities", pl)
+	}
+	if ps.Validate(2) != nil || ps.Validate(3) != ErrInvalidPriority {
+		t.Fatal("wrong validation")
+	}
+}
+
+func TestSchedulerPrioritySet(t *testing.T) {
+	ps := NewPrioritySet("low", "high")
+	rl := newManual(Config{PriorityAutoInit: true, PrioritySet: ps})
+	defer rl.Stop()
+	ps.Init(rl, 0)
+
+	high, _ := ps.Priority("high")
+	if err := rl.Add(high, &testOp{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.Add(12, &testOp{}); err != ErrInvalidPriority {
+		t.Fatal("priorities outside of the set should be rejected")
+	}
+	if _, ok := rl.pl[12]; ok {
+		t.Fatal("priorities outside of the set must not be auto-initialized")
+	}
+}
@@ -0,0 +1,43 @@
+package scheduler
+
+// OpID identifies an operation that has been added to a Scheduler.
+// IDs are unique within a single Scheduler.
+type OpID uint64
+
+// AddID adds a new operation to the scheduler like Add does, and returns
+// the ID of the operation which can be used to promote it later on.
+// The ID is 0 when the operation was forwarded to the overflow scheduler.
+func (s *Scheduler) AddID(p Priority, o Operation) (OpID, error) {
+	return s.addID(p, queuedOp{op: o}, false, true)
+}
+
+// Promote moves a pending operation to the back of another priority, e.g.
+// when a background task suddenly becomes urgent. The operation keeps the
+// moment it was added. It returns ErrUnknownOperation when the operation
+// has already been dispatched or removed.
+func (s *Scheduler) Promote(id OpID, p Priority) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	to, err := s.getPriorityMetadata(s.mapPriority(p))
+	if err != nil {
+		return err
+	}
+	for _, pm := range s.opl {
+		for i := 0; i < int(pm.curops); i++ {
+			q := pm.at(i)
+			if q.id != id {
+				continue
+			}
+			if pm == to {
+				return nil
+			}
+			if err := to.push(q); err != nil {
+				return err
+			}
+			pm.take(i)
+			return nil
+		}
+	}
+	return ErrUnknownOperation
+}
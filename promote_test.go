@@ -0,0 +1,34 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerPromote(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	var order []int
+	rl.Add(1, Closure(func() { order = append(order, 1) }))
+	id, err := rl.AddID(1, Closure(func() { order = append(order, 2) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl.Add(2, Closure(func() { order = append(order, 3) }))
+
+	if err := rl.Promote(id, 2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		rl.tick(time.Now())
+	}
+	if len(order) != 3 || order[0] != 3 || order[1] != 2 || order[2] != 1 {
+		t.Fatal("promoted operation should run ahead of lower priorities", order)
+	}
+	if err := rl.Promote(id, 2); err != ErrUnknownOperation {
+		t.Fatal("dispatched operation can't be promoted", err)
+	}
+}
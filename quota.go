@@ -0,0 +1,62 @@
+package scheduler
+
+import "time"
+
+// quota guarantees a priority a minimum amount of dispatches per window.
+type quota struct {
+	n      int           // Guaranteed dispatches per window.
+	window time.Duration // The length of a window.
+	start  time.Time     // The start of the current window.
+	used   int           // Dispatches during the current window.
+}
+
+// behind reports whether the priority has been dispatched less often than
+// its quota requires at this point of the current window.
+func (q *quota) behind(now time.Time) bool {
+	if now.Sub(q.start) >= q.window {
+		q.start = now
+		q.used = 0
+	}
+	return float64(q.used) < float64(q.n)*float64(now.Sub(q.start))/float64(q.window)
+}
+
+// SetPriorityQuota guarantees priority p at least n dispatches per window,
+// even when more urgent priorities have pending operations. Apart from that
+// the priorities are still dispatched in order. The quota is spread evenly
+// over the window, so a priority that falls behind is dispatched before the
+// other priorities until it has caught up. The quota is counted against the
+// rate of the scheduler. When Config.Window is set, the quota is counted per
+// scheduling window instead and window is ignored, see Config.Window.
+// A quota of 0 or less removes the quota of p.
+func (s *Scheduler) SetPriorityQuota(p Priority, n int, window time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pm, err := s.getPriorityMetadata(s.mapPriority(p))
+	if err != nil {
+		return err
+	}
+	if pm.quota != nil {
+		s.quotas--
+	}
+	pm.quota = nil
+	if n > 0 && window > 0 {
+		pm.quota = &quota{n: n, window: window, start: time.Now()}
+		s.quotas++
+	}
+	return nil
+}
+
+// quotaOp takes the next operation of the most urgent priority that is
+// behind its quota. The caller must hold the lock.
+func (s *Scheduler) quotaOp(now time.Time) (queuedOp, bool) {
+	for i := len(s.opl) - 1; i >= 0 && !s.overBudget; i-- {
+		pm := s.opl[i]
+		if pm.quota == nil || !pm.quota.behind(now) {
+			continue
+		}
+		if q, ok := s.takeFrom(pm); ok {
+			return q, true
+		}
+	}
+	return queuedOp{}, false
+}
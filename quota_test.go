@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerPriorityQuota(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+	if err := rl.SetPriorityQuota(3, 1, time.Second); err != ErrInvalidPriority {
+		t.Fatal("a quota requires an existing priority", err)
+	}
+	if err := rl.SetPriorityQuota(1, 5, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	low := 0
+	for i := 0; i < 200; i++ {
+		rl.Add(1, Closure(func() { low++ }))
+		rl.Add(2, &testOp{})
+	}
+	start := time.Now()
+	for time.Since(start) < 100*time.Millisecond {
+		rl.tick(time.Now())
+		time.Sleep(2 * time.Millisecond)
+	}
+	if low < 4 || low > 6 {
+		t.Fatal("the low priority should receive its quota", low)
+	}
+
+	rl.SetPriorityQuota(1, 0, 0)
+	low = 0
+	for i := 0; i < 10; i++ {
+		rl.tick(time.Now())
+		time.Sleep(2 * time.Millisecond)
+	}
+	if low != 0 {
+		t.Fatal("without a quota the low priority should starve", low)
+	}
+}
+
+func TestSchedulerPriorityQuotaReset(t *testing.T) {
+	rl := newManual(Config{})
+	rl.InitPriority(1, 0)
+	rl.SetPriorityQuota(1, 5, time.Second)
+	rl.Stop()
+	if err := rl.Reset(Config{}); err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Stop()
+	if rl.quotas != 0 {
+		t.Fatal("a reset should clear the quotas", rl.quotas)
+	}
+}
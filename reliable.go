@@ -0,0 +1,68 @@
+package scheduler
+
+// AddReliable adds a new operation that is executed at least once.
+// The operation isn't considered done until Execute returns normally: when
+// it panics, the panic is recovered and the operation is added to the same
+// priority again, at most retries times. When it keeps panicking, a
+// PanicError is passed to the OnError hook. Errors that occur when the
+// operation is added again are passed to the OnError hook as well, unless the
+// scheduler has been stopped in the meantime. An operation that implements
+// MetaOperation is executed through ExecuteMeta.
+func (s *Scheduler) AddReliable(p Priority, o Operation, retries int) error {
+	r := &reliableOperation{s: s, p: p, o: o, retries: retries}
+	r.self = r
+	if _, ok := o.(MetaOperation); ok {
+		r.self = &reliableMetaOperation{r}
+	}
+	return s.Add(p, r.self)
+}
+
+// reliableOperation retries an operation that panics.
+type reliableOperation struct {
+	s       *Scheduler
+	p       Priority
+	o       Operation
+	self    Operation // The operation that is added again, r or its meta wrapper.
+	id      OpID      // The ID of the last dispatch.
+	retries int
+}
+
+func (r *reliableOperation) Execute() {
+	r.run(r.o.Execute)
+}
+
+// run calls exec and adds the operation again when exec panics.
+func (r *reliableOperation) run(exec func()) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		if r.retries <= 0 {
+			r.s.handleError(&PanicError{Value: v}, r.id)
+			return
+		}
+		r.retries--
+		if err := r.s.readd(r.p, r.self); err != nil && err != ErrStopped {
+			r.s.handleError(err, r.id)
+		}
+	}()
+	exec()
+}
+
+func (r *reliableOperation) identify(s *Scheduler, id OpID) {
+	r.s, r.id = s, id
+}
+
+func (r *reliableOperation) unwrap() interface{} {
+	return r.o
+}
+
+// reliableMetaOperation is a reliableOperation around a MetaOperation.
+type reliableMetaOperation struct {
+	*reliableOperation
+}
+
+func (r *reliableMetaOperation) ExecuteMeta(m OpMeta) {
+	r.run(func() { r.o.(MetaOperation).ExecuteMeta(m) })
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerAddReliable(t *testing.T) {
+	var errs []error
+	rl := newManual(Config{OnError: func(err error, _ OpID) { errs = append(errs, err) }})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	attempts := 0
+	rl.AddReliable(1, Closure(func() {
+		attempts++
+		if attempts < 3 {
+			panic("worker died")
+		}
+	}), 3)
+	for i := 0; i < 5; i++ {
+		rl.tick(time.Now())
+	}
+	if attempts != 3 || len(errs) != 0 {
+		t.Fatal("operation should be retried until it succeeds", attempts, errs)
+	}
+
+	rl.AddReliable(1, Closure(func() { panic("always") }), 1)
+	for i := 0; i < 3; i++ {
+		rl.tick(time.Now())
+	}
+	if len(errs) != 1 {
+		t.Fatal("a PanicError should be reported after the retries", errs)
+	}
+	if pe, ok := errs[0].(*PanicError); !ok || pe.Value != "always" {
+		t.Fatal("wrong error", errs[0])
+	}
+}
+
+type flakyMetaOp struct {
+	ids []OpID
+}
+
+func (o *flakyMetaOp) Execute() { panic("Execute shouldn't be called") }
+
+func (o *flakyMetaOp) ExecuteMeta(m OpMeta) {
+	o.ids = append(o.ids, m.ID)
+	if len(o.ids) == 1 {
+		panic("worker died")
+	}
+}
+
+func TestSchedulerAddReliableMeta(t *testing.T) {
+	var errs []error
+	rl := newManual(Config{OnError: func(err error, _ OpID) { errs = append(errs, err) }})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	o := &flakyMetaOp{}
+	rl.AddReliable(1, o, 1)
+	for i := 0; i < 2; i++ {
+		rl.tick(time.Now())
+	}
+	if len(o.ids) != 2 || len(errs) != 0 {
+		t.Fatal("the retries should be executed through ExecuteMeta", o.ids, errs)
+	}
+}
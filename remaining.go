@@ -0,0 +1,67 @@
+package scheduler
+
+import "time"
+
+// ReportRemaining corrects the pacing of the scheduler using the amount of
+// requests a remote rate limit reports to have remaining until resetAt,
+// e.g. from the response headers of an API. The rate is lowered to spread
+// the remaining requests evenly over the time until the reset, but never
+// raised above the rate in use before the first report. When no requests
+// remain, the scheduler pauses until the reset. Once resetAt has passed,
+// the previous rate is restored. A new report replaces the previous one,
+// and SetRate ends it, as well as an active warm-up or boost.
+func (s *Scheduler) ReportRemaining(remaining int, resetAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until := time.Until(resetAt)
+	if until <= 0 || s.stopped {
+		return
+	}
+
+	base := s.rate
+	if s.warmUp > 0 {
+		base = s.warmTarget
+		s.warmUp = 0
+	}
+	if s.boost != nil {
+		base = s.boostBase
+		s.endBoost()
+	}
+	if s.report != nil {
+		base = s.reportBase
+		s.endReport()
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(until, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.report == t && !s.stopped {
+			s.report = nil
+			s.setRate(s.reportBase)
+		}
+	})
+	s.report = t
+	s.reportBase = base
+
+	if remaining <= 0 {
+		if resetAt.After(s.pause) {
+			s.pauseFor(until)
+		}
+		return
+	}
+	rate := float32(float64(remaining) / until.Seconds())
+	if rate > base {
+		rate = base
+	}
+	s.setRate(rate)
+}
+
+// endReport cancels the restoration of the rate after a reported reset.
+// The caller must hold the lock.
+func (s *Scheduler) endReport() {
+	if s.report != nil {
+		s.report.Stop()
+		s.report = nil
+	}
+}
@@ -40,6 +40,8 @@
 // synchronously from within the loop that processes ticks from the internal
 // ticker. The disadvantage here is that it will cause the main loop to block,
 // the advantage is that it won't execute any expensive context switching.
+// Operations that take longer than the interval between ticks make the
+// scheduler fall behind its rate, which can be detected using OnSyncBlock.
 //
 // Bursts
 //
@@ -49,8 +51,8 @@
 //
 // Implementing burst behavior can be done by lowering the allocated rate of
 // operations of the scheduler and using a separate system to allocate those
-// additional operations. It can also be done by 'saving up' operations through
-// the Fallback operation.
+// additional operations, such as the BurstAllocator. It can also be done by
+// 'saving up' operations through the Fallback operation.
 package scheduler
 
 // (TODO): Provide hooks for "queue entries above/below x" for both the
@@ -59,11 +61,16 @@ package scheduler
 // which can be used by both the Priorities as well as the Scheduler itself.
 // (TODO): Optionally make the Scheduler stand-by until it receives an operation.
 // (TODO): Make the scheduler use an implementation of the "Tickable" interface.
-// (TODO): Create exhaustive unit tests.
 
 import (
+	"context"
 	"errors"
+	"math/rand"
+	"runtime/pprof"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -72,73 +79,335 @@ var (
 	ErrInvalidPriority  = errors.New("Scheduler: Priority is not initizlaized")
 	ErrMaxCapacity      = errors.New("Scheduler: Maximum Queue Capacity Exceeded")
 	ErrPriorityCapacity = errors.New("Priority: Maximum Priority-Specific Queue Capacity Exceeded")
+	ErrNotStopped       = errors.New("Scheduler: Scheduler is not stopped")
+	ErrUnknownOperation = errors.New("Scheduler: Operation is not pending")
+	ErrDraining         = errors.New("Scheduler: Scheduler is draining")
+	ErrStopped          = errors.New("Scheduler: Scheduler is stopped")
 )
 
-func worker(ch chan Operation) {
+func (s *Scheduler) worker(ch chan Operation) {
 	for {
 		op, more := <-ch
 		if !more {
 			break
 		}
+		if s.holdBuffer {
+			s.waitPause()
+		}
 		op.Execute()
+		atomic.AddInt64(&s.inFlight, -1)
+		if s.inflight != nil {
+			<-s.inflight
+		}
 	}
 }
 
+// startWorker starts the i-th worker goroutine that reads from ch.
+func (s *Scheduler) startWorker(ch chan Operation, i int) {
+	s.wg.Add(1)
+	go func() {
+		if s.labelPrefix != "" {
+			labels := pprof.Labels("worker", s.labelPrefix+strconv.Itoa(i))
+			pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), labels))
+		}
+		s.worker(ch)
+		s.wg.Done()
+	}()
+}
+
 // Scheduler schedules operations against a specific rate limit.
 type Scheduler struct {
-	pause        time.Time      // The time until the scheduler must pause.
-	usingWorkers bool           // Whether separate goroutine workers are used.
-	opqueue      chan Operation // Queue of pending operations for the workers.
-	fallback     Operation      // Fallback operation in case no operations are available.
-	stop         chan bool      // Used to stop the ticker goroutine.
-	ticker       *time.Ticker   // The internal ticker.
+	ticks        uint64 // Processed ticks, first to be 64-bit aligned for atomic access.
+	fallbackRuns uint64 // The amount of fallback executions, accessed atomically.
+	inFlight     int64  // Unfinished operations sent to the workers, accessed atomically.
+	fbRunning    int32  // Whether an asynchronous fallback runs, accessed atomically.
+
+	usingWorkers  bool            // Whether separate goroutine workers are used.
+	executor      func(Operation) // Custom executor replacing the workers.
+	opqueue       chan Operation  // Queue of pending operations for the workers.
+	qmu           sync.RWMutex    // Guards replacing and closing the opqueue.
+	qclosed       bool            // Whether the opqueue has been closed, guarded by qmu.
+	pbuf          *priorityBuffer // Orders the operations inside the opqueue, if any.
+	inflight      chan struct{}   // Semaphore limiting the operations in flight.
+	holdBuffer    bool            // Whether workers hold operations during a pause.
+	labelPrefix   string          // Prefix of the pprof labels of the workers.
+	fallback      Operation       // Fallback operation in case no operations are available.
+	fallbackErr   ErrorOperation  // Fallback operation that can fail.
+	fbBreaker     *FallbackBreaker
+	fbState       fallbackState
+	fallbackPause bool          // Whether the fallback runs during a pause.
+	asyncFallback bool          // Whether the workers execute the fallback.
+	overflow      *Scheduler    // Receives the operations beyond the capacity.
+	blockOnFull   bool          // Whether Add waits for room inside the queue.
+	addTimeout    time.Duration // Maximum time Add waits for room, if any.
+	space         chan struct{} // Closed when room becomes available.
+	stop          chan struct{} // Closed to stop the ticker goroutine.
+	done          chan struct{} // Closed when the ticker goroutine has returned.
+	stopOnce      sync.Once     // Makes sure the scheduler is only stopped once.
+	onStop        func()        // Called at the end of Stop.
+	onTick        func(bool)    // Called at the end of every tick.
+	onLag         func(time.Duration)
+	lagThreshold  time.Duration
+	onBufferFull  func()              // Called when the execution buffer is full.
+	onSyncBlock   func(time.Duration) // Called when a synchronous operation is slow.
+	onDrop        func(Operation, DropReason, OpID)
+	drain         func(Operation) // Receives the pending operations on Stop.
+	middleware    []func(Operation) Operation
+	dryRun        bool            // Whether operations are passed to onDryRun instead.
+	onDryRun      func(Operation) // Receives the operations during a dry run.
+	wg            sync.WaitGroup  // Tracks the running workers.
+	ticker        *time.Ticker    // The internal ticker.
+	sourceTicks   chan sourceTick
+	sources       sync.WaitGroup // Tracks the tick source goroutines.
+	sourceCounts  []uint64       // Dispatched operations per tick source.
+
+	pai bool      // Priority Auto Initialization
+	pdc int       // Priority default capacity
+	dp  *Priority // Default priority
+
+	pmap func(Priority) Priority // Maps requested priorities.
+	ps   *PrioritySet            // The declared set of priorities, if any.
+
+	onInit  func(Priority, bool)   // Called when a priority is created.
+	onRate  func(float32, float32) // Called when the rate changes.
+	onError func(error, OpID)      // Called when an ErrorOperation fails.
+	lastErr atomic.Value           // Holds the last error as an errorValue.
+
+	mu         *sync.Mutex                    // Mutex
+	pl         map[Priority]*priorityMetadata // Mapped priority list.
+	opl        []*priorityMetadata            // Ordered priority list.
+	lowerFirst bool                           // Whether lower values are dispatched first.
+	less       func(a, b QueuedOp) bool       // Orders the operations inside a priority.
+	curops     uint32                         // total operations inside the scheduler queue.
+	peak       uint32                         // The highest amount of operations inside the queue.
+	deadlines  int                            // Amount of operations with a dispatch deadline.
+	lastID     OpID                           // The ID of the last added operation.
+	lastJob    uint64                         // The ID of the last created Job.
+	debt       int                            // Ticks owed for operations executed by ExecuteNow.
+	maxops     uint32                         // max is the maximum amount of operations that can be in the scheduler.
+
+	bytesPerTick int  // The byte budget granted by every tick, if any.
+	budget       int  // The remaining byte budget.
+	overBudget   bool // Whether the budget doesn't cover the next operation.
+
+	budgetFn    func(time.Duration) float64 // The budget function, if any.
+	budgetStart time.Time                   // The start of the budget function.
+	budgetUsed  float64                     // The budget used so far.
+
+	pause    time.Time     // The time until the scheduler must pause.
+	rate     float32       // The current amount of operations per second.
+	interval time.Duration // The time between two ticks at the current rate.
+	workers  int           // The amount of worker goroutines.
+	lastTick time.Time     // The time of the last processed tick.
+	stopped  bool          // Whether the scheduler has been stopped.
+	draining int           // The amount of active calls to Drain.
+
+	warmUp     time.Duration // Duration of the warm-up, 0 when it's done.
+	warmStart  time.Time     // Start of the warm-up.
+	warmTarget float32       // Rate at the end of the warm-up.
+
+	boost     *time.Timer // Restores the rate at the end of a boost.
+	boostBase float32     // The rate to restore after a boost.
+
+	minInterval  time.Duration // The minimum time between two dispatches.
+	lastDispatch time.Time     // The time of the last dispatch by execOp.
+
+	unlimited bool          // Whether operations are dispatched without ticks.
+	wake      chan struct{} // Signals an unlimited scheduler that operations were added.
+
+	report     *time.Timer // Restores the rate after a reported reset.
+	reportBase float32     // The rate to restore after a reported reset.
+
+	postPauseFair bool   // Whether to recover fairly from a pause.
+	wasPaused     bool   // Whether the previous tick was paused.
+	recovering    bool   // Whether the backlog of a pause is being cleared.
+	pauseDepth    uint32 // The amount of operations when the pause started.
+	pauseGen      uint64 // Incremented by every Pause and Resume.
+	turn          int    // The next priority in turn during the recovery.
+
+	groups  map[string]*rateGroup // Rate limited operation groups.
+	minimum func()                // The pending call of a minimum callback.
+	quotas  int                   // The amount of priorities with a quota.
+
+	window     int // The length of a scheduling window in ticks, if any.
+	windowTick int // The ticks elapsed in the current window.
+
+	onStarvation        func(Priority, time.Duration) // Called when an operation starves.
+	starvationThreshold time.Duration                 // The wait after which an operation starves.
 
-	pai bool // Priority Auto Initialization
-	pdc int  // Priority default capacity
+	watchers []chan QueueEvent // Channels returned by Watch.
+	tags     map[string]uint64 // Dispatched operations per tag.
 
-	mu     *sync.Mutex                    // Mutex
-	pl     map[Priority]*priorityMetadata // Mapped priority list.
-	opl    []*priorityMetadata            // Ordered priority list.
-	curops uint32                         // total operations inside the scheduler queue.
-	maxops uint32                         // max is the maximum amount of operations that can be in the scheduler.
+	cfg       Config     // The configuration, updated by the setters.
+	selection Selection  // Strategy used to select the next priority.
+	weights   *rand.Rand // Source of randomness for weighted selection.
 }
 
 // New creates a newly initialized Scheduler instance.
 func New(c Config) *Scheduler {
-	s := &Scheduler{
-		mu:       new(sync.Mutex),
-		pl:       make(map[Priority]*priorityMetadata, 5),
-		opl:      make([]*priorityMetadata, 0, 5),
-		pai:      c.PriorityAutoInit,
-		pdc:      c.PriorityDefaultCapacity,
-		maxops:   c.maxops(),
-		fallback: c.Fallback,
-		stop:     make(chan bool),
+	s := new(Scheduler)
+	s.init(c)
+	return s
+}
+
+// init initializes the scheduler using the configuration and starts its
+// background processes.
+func (s *Scheduler) init(c Config) {
+	s.mu = new(sync.Mutex)
+	s.cfg = c
+	s.pl = make(map[Priority]*priorityMetadata, 5)
+	s.opl = make([]*priorityMetadata, 0, 5)
+	s.curops = 0
+	s.peak = 0
+	s.deadlines = 0
+	s.bytesPerTick = c.BytesPerTick
+	s.budget = 0
+	s.budgetFn = c.Budget
+	s.budgetStart = time.Now()
+	s.budgetUsed = 0
+	s.debt = 0
+	s.tags = make(map[string]uint64)
+	s.maxops = c.maxops()
+	s.pai = c.PriorityAutoInit
+	s.pdc = c.PriorityDefaultCapacity
+	s.dp = c.DefaultPriority
+	s.pmap = c.PriorityMapper
+	s.ps = c.PrioritySet
+	s.onInit = c.OnPriorityInit
+	s.onRate = c.OnRateChange
+	s.onError = c.OnError
+	s.onStop = c.OnStop
+	s.onTick = c.OnTick
+	s.onLag = c.OnLag
+	s.onBufferFull = c.OnBufferFull
+	s.onSyncBlock = c.OnSyncBlock
+	s.onStarvation = c.OnStarvation
+	s.starvationThreshold = c.StarvationThreshold
+	s.onDrop = c.OnDrop
+	s.lagThreshold = c.LagThreshold
+	s.drain = c.DrainHandler
+	s.middleware = c.Middleware
+	s.less = c.Less
+	s.dryRun = c.DryRun
+	s.onDryRun = c.OnDryRun
+	s.fallback = c.Fallback
+	s.fallbackErr = c.FallbackErr
+	s.fbBreaker = c.FallbackBreaker
+	s.fbState = fallbackState{}
+	s.fallbackPause = c.FallbackDuringPause
+	s.asyncFallback = c.AsyncFallback
+	s.overflow = c.Overflow
+	s.blockOnFull = c.BlockOnFull
+	s.addTimeout = c.AddTimeout
+	s.executor = c.Executor
+	s.holdBuffer = c.PauseHoldsBuffer
+	s.labelPrefix = c.WorkerLabelPrefix
+	s.rate = c.rate()
+	s.warmUp = c.WarmUp
+	if s.warmUp > 0 {
+		s.warmTarget = s.rate
+		s.warmStart = time.Now()
+		s.rate *= warmUpStart
 	}
+	s.interval = interval(s.rate)
+	s.pause = time.Time{}
+	s.boost = nil
+	s.report = nil
+	s.postPauseFair = c.PostPauseFairness
+	s.wasPaused = false
+	s.recovering = false
+	s.pauseDepth = 0
+	s.turn = 0
+	s.draining = 0
+	s.lastTick = time.Time{}
+	s.stopped = false
+	atomic.StoreUint64(&s.ticks, 0)
+	atomic.StoreUint64(&s.fallbackRuns, 0)
+	s.groups = nil
+	s.minimum = nil
+	s.quotas = 0
+	s.window = c.Window
+	s.windowTick = 0
+	s.overBudget = false
+	s.selection = c.Selection
+	s.lowerFirst = c.PriorityOrder == LowerFirst
+	s.weights = rand.New(rand.NewSource(time.Now().UnixNano()))
+	s.lastErr.Store(errorValue{})
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.unlimited = c.Unlimited
+	s.minInterval = c.MinInterval
+	s.lastDispatch = time.Time{}
+	s.wake = nil
+	if s.unlimited {
+		s.wake = make(chan struct{}, 1)
+	}
+	s.stopOnce = sync.Once{}
 
 	// When using workers we must initialize the workers and the operation queue.
-	if c.Workers > 0 {
+	s.opqueue, s.inflight, s.usingWorkers, s.workers = nil, nil, false, 0
+	s.qclosed = false
+	s.pbuf = nil
+	if workers := c.workers(); workers > 0 && c.Executor == nil {
 		s.opqueue = make(chan Operation, c.opbuf())
 		s.usingWorkers = true
-		for i := 0; i < c.Workers; i++ {
-			go worker(s.opqueue)
+		if c.PriorityBuffers {
+			s.pbuf = &priorityBuffer{lowerFirst: s.lowerFirst}
+		}
+		s.workers = workers
+		if c.MaxInFlight > 0 {
+			s.inflight = make(chan struct{}, c.MaxInFlight)
+		}
+		for i := 0; i < workers; i++ {
+			s.startWorker(s.opqueue, i)
 		}
 	}
 
 	// Start a new ticker based on the configured rate and start processing ticks.
-	s.ticker = time.NewTicker(time.Duration(float32(time.Second) / c.rate()))
+	s.ticker = time.NewTicker(s.interval)
+	s.sourceCounts = make([]uint64, len(c.Sources)+1)
+	s.sourceTicks = make(chan sourceTick)
+	for i, ops := range c.Sources {
+		s.sources.Add(1)
+		go s.processSource(i+1, Config{OPS: ops}.interval(), s.stop, s.sourceTicks)
+	}
 	go s.processTicks()
+}
 
-	return s
+// Reset reinitializes a stopped scheduler using a new configuration and
+// restarts its background processes. Operations and priorities of the old
+// configuration are discarded. It returns ErrNotStopped when the scheduler
+// hasn't been stopped. The scheduler must not be used concurrently with
+// Reset.
+func (s *Scheduler) Reset(c Config) error {
+	s.mu.Lock()
+	stopped := s.stopped
+	s.mu.Unlock()
+	if !stopped {
+		return ErrNotStopped
+	}
+	s.init(c)
+	return nil
 }
 
 // processTicks processes ticks in a background goroutine.
 func (s *Scheduler) processTicks() {
+	defer close(s.done)
 	for {
 		select {
 		case t := <-s.ticker.C:
-			if s.pause.Before(t) {
-				s.execOp()
+			if s.tick(t) {
+				atomic.AddUint64(&s.sourceCounts[0], 1)
+				if s.unlimited {
+					s.runUnlimited()
+				}
+			}
+		case <-s.wake:
+			s.runUnlimited()
+		case st := <-s.sourceTicks:
+			if s.tick(st.t) {
+				atomic.AddUint64(&s.sourceCounts[st.source], 1)
 			}
 		case <-s.stop:
 			return
@@ -146,135 +415,1058 @@ func (s *Scheduler) processTicks() {
 	}
 }
 
-func (s *Scheduler) execOp() {
-	o := s.getNextOp()
-	if o == nil {
-		if s.fallback == nil {
-			return
+// tick processes a single tick of the ticker.
+// It returns whether an operation was dispatched.
+func (s *Scheduler) tick(t time.Time) bool {
+	atomic.AddUint64(&s.ticks, 1)
+	s.mu.Lock()
+	s.lastTick = t
+	paused := !s.pause.Before(t)
+	if paused {
+		s.wasPaused = true
+	} else if s.wasPaused {
+		s.wasPaused = false
+		s.recovering = s.postPauseFair
+	}
+	var threshold time.Duration
+	if s.onLag != nil {
+		threshold = s.lagThreshold
+		if threshold <= 0 {
+			threshold = s.interval
 		}
-		s.fallback.Execute()
-		return
 	}
+	if s.warmUp > 0 {
+		s.warm(t)
+	}
+	if s.window > 0 {
+		s.advanceWindow(t)
+	}
+	var starved []starvation
+	if s.onStarvation != nil {
+		starved = s.starving(t)
+	}
+	// The tick pays off an operation executed by ExecuteNow.
+	owed := !paused && s.debt > 0
+	if owed {
+		s.debt--
+	}
+	s.mu.Unlock()
+
+	for _, st := range starved {
+		s.onStarvation(st.p, st.waited)
+	}
+
+	// The ticker buffers a single tick while the loop is blocked, so a late
+	// tick shows how long the loop was unable to process ticks.
+	if lag := time.Since(t); s.onLag != nil && lag > threshold {
+		s.onLag(lag)
+	}
+
+	executed := false
+	if !paused && !owed {
+		switch {
+		case s.budgetFn != nil:
+			executed = s.execBudget(t)
+		case s.bytesPerTick > 0:
+			executed = s.execBytes()
+		default:
+			executed = s.execOp()
+		}
+	} else if paused && s.fallbackPause {
+		s.runFallback()
+	}
+	if s.onTick != nil {
+		s.onTick(executed)
+	}
+	return executed
+}
+
+// ExecuteNow executes an operation immediately from within the calling
+// goroutine, bypassing the queue, the rate and any pause. It's an escape
+// hatch for urgent operations, such as a critical cancellation.
+// To preserve the average rate, the operation counts against the budget of
+// the next tick that isn't paused, which won't dispatch an operation.
+func (s *Scheduler) ExecuteNow(o Operation) {
+	s.mu.Lock()
+	s.debt++
+	s.mu.Unlock()
+	s.prepare(queuedOp{op: o, enqueued: time.Now()}).Execute()
+}
 
-	if s.usingWorkers {
+// execOp dispatches the next pending operation, or executes the fallback
+// when no operations are available. It returns whether an operation was
+// dispatched.
+func (s *Scheduler) execOp() bool {
+	dispatched, empty := s.dispatchNext()
+	if empty {
+		s.runFallback()
+	}
+	return dispatched
+}
+
+// dispatchNext dispatches the next pending operation and returns whether it
+// did so. Nothing happens until MinInterval has passed since the previous
+// dispatch. The returned empty is true when no operation is available.
+func (s *Scheduler) dispatchNext() (dispatched, empty bool) {
+	if s.minInterval > 0 && time.Since(s.lastDispatch) < s.minInterval {
+		return false, false
+	}
+	q, ok := s.getNextOp()
+	if !ok {
+		return false, true
+	}
+	if s.minInterval > 0 {
+		s.lastDispatch = time.Now()
+	}
+	s.dispatch(s.prepare(q), q.priority)
+	return true, false
+}
+
+// prepare returns the operation that must be dispatched for q, wrapped by
+// the configured middleware.
+func (s *Scheduler) prepare(q queuedOp) Operation {
+	o := q.operation(s)
+	if s.dryRun {
+		o = s.dryRunOp(q.op)
+	}
+	for _, mw := range s.middleware {
+		o = mw(o)
+	}
+	return o
+}
+
+// dryRunOp returns the operation that replaces o during a dry run. The
+// callback of o, if any, is called as if o was executed successfully.
+func (s *Scheduler) dryRunOp(o Operation) Operation {
+	return Closure(func() {
+		if s.onDryRun != nil {
+			s.onDryRun(o)
+		}
+		if f, ok := o.(finisher); ok {
+			f.finish(nil)
+		}
+	})
+}
+
+// dispatch hands a single operation of priority p over for execution.
+// It returns false when the workers have already been stopped, in which
+// case the operation isn't executed.
+func (s *Scheduler) dispatch(o Operation, p Priority) bool {
+	switch {
+	case s.executor != nil:
+		s.executor(o)
+	case s.usingWorkers:
+		if s.inflight != nil {
+			s.inflight <- struct{}{}
+		}
+		s.qmu.RLock()
+		full := len(s.opqueue) == cap(s.opqueue)
+		s.qmu.RUnlock()
+		if full && s.onBufferFull != nil {
+			s.onBufferFull()
+		}
+
+		s.qmu.RLock()
+		defer s.qmu.RUnlock()
+		if s.qclosed {
+			if s.inflight != nil {
+				<-s.inflight
+			}
+			return false
+		}
+		atomic.AddInt64(&s.inFlight, 1)
+		if s.pbuf != nil {
+			s.pbuf.push(o, p)
+			o = s.pbuf
+		}
 		s.opqueue <- o
-	} else {
+	case s.onSyncBlock != nil:
+		start := time.Now()
+		o.Execute()
+		d := time.Since(start)
+		s.mu.Lock()
+		iv := s.interval
+		s.mu.Unlock()
+		if d > iv {
+			s.onSyncBlock(d)
+		}
+	default:
 		o.Execute()
 	}
+	return true
 }
 
-// getOperation removes and returns the next pending operation.
-func (s *Scheduler) getNextOp() Operation {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	for i := 0; i < len(s.opl); i++ {
-		op, ok := s.opl[i].GetOperation()
-		if ok {
-			s.curops--
-			return op
+// getNextOp removes and returns the next pending operation.
+// If no operation is available, the returned bool will be false.
+// Operations whose predicate, as passed to AddIf, returns false are
+// dropped and skipped in favor of the next operation.
+func (s *Scheduler) getNextOp() (queuedOp, bool) {
+	for {
+		s.mu.Lock()
+		var expired []queuedOp
+		if s.deadlines > 0 {
+			expired = s.expire(time.Now())
+		}
+		q, ok := s.nextOp()
+		minimum := s.minimum
+		s.minimum = nil
+		s.mu.Unlock()
+
+		if minimum != nil {
+			minimum()
+		}
+		s.drop(expired, DropExpired)
+		if !ok || q.shouldRun == nil {
+			return q, ok
+		}
+		if q.shouldRun() {
+			s.mu.Lock()
+			if pm, ok := s.pl[q.priority]; ok {
+				s.account(pm, q)
+			}
+			s.mu.Unlock()
+			return q, true
 		}
+		s.drop([]queuedOp{q}, DropCancelled)
 	}
-	return nil
+}
+
+// nextOp removes and returns the next pending operation according to the
+// selection strategy. The caller must hold the lock.
+func (s *Scheduler) nextOp() (queuedOp, bool) {
+	if len(s.groups) > 0 {
+		s.refillGroups(time.Now())
+	}
+	if s.window > 0 {
+		return s.windowOp()
+	}
+	if s.recovering && s.curops > s.pauseDepth {
+		q, ok := s.getFairOp()
+		s.recovering = s.curops > s.pauseDepth
+		return q, ok
+	}
+	s.recovering = false
+	if s.quotas > 0 {
+		if q, ok := s.quotaOp(time.Now()); ok {
+			return q, true
+		}
+	}
+	if s.selection == SelectWeightedRandom {
+		return s.getWeightedOp()
+	}
+	return s.strictOp()
+}
+
+// strictOp removes and returns an operation of the most urgent priority
+// that may be dispatched. The caller must hold the lock.
+func (s *Scheduler) strictOp() (queuedOp, bool) {
+	// The ordered priority list is sorted from the least to the most urgent
+	// priority, so it's scanned from back to front.
+	for i := len(s.opl) - 1; i >= 0 && !s.overBudget; i-- {
+		if q, ok := s.takeFrom(s.opl[i]); ok {
+			return q, true
+		}
+	}
+	return queuedOp{}, false
+}
+
+// takeFrom removes and returns the first operation of the priority that
+// may be dispatched. The caller must hold the lock.
+func (s *Scheduler) takeFrom(pm *priorityMetadata) (queuedOp, bool) {
+	i, ok := s.eligible(pm)
+	if !ok {
+		return queuedOp{}, false
+	}
+	if s.bytesPerTick > 0 && !s.fits(pm.at(i).op) {
+		return queuedOp{}, false
+	}
+	q := pm.take(i)
+	s.minimum = pm.minimumCall()
+	if q.deadline > 0 {
+		s.deadlines--
+	}
+	s.curops--
+	s.freeSpace()
+	s.notify(QueueDequeue, pm)
+	// An operation added using AddIf only uses up the rate once its
+	// predicate allowed it to run.
+	if q.shouldRun == nil {
+		s.account(pm, q)
+	}
+	return q, true
+}
+
+// account charges a dispatched operation to the rate of its group, the
+// quota of its priority and the statistics. The caller must hold the lock.
+func (s *Scheduler) account(pm *priorityMetadata, q queuedOp) {
+	if rg, ok := s.groups[q.group]; ok {
+		rg.tokens--
+	}
+	if pm.quota != nil {
+		pm.quota.used++
+	}
+	s.count(q.op)
+	pm.history.record(time.Now())
 }
 
 // InitPriority initializes a new priority and specifies the maximum
 // operation queue for the specific priority. If maxops equals 0, no
 // priority-specific limit will be applied.
-func (s *Scheduler) InitPriority(p Priority, maxops int) {
+// It returns true when the priority was created and false when an already
+// initialized priority had its capacity overwritten.
+func (s *Scheduler) InitPriority(p Priority, maxops int) bool {
 	s.mu.Lock()
-	s.initPriority(p, maxops)
-	s.mu.Unlock()
+	defer s.mu.Unlock()
+	return s.initPriority(s.mapPriority(p), maxops, false)
 }
 
-func (s *Scheduler) initPriority(p Priority, maxops int) {
+func (s *Scheduler) initPriority(p Priority, maxops int, auto bool) bool {
 	// If the priority already exists, simply overwrite the maxops.
 	// Make sure to lock the mutex to avoid any race-conditions.
 	if pr, ok := s.pl[p]; ok {
 		pr.maxops = getMaxops(maxops)
-		return
+		return false
 	}
 
 	pm := newPriorityMetadata(p, maxops)
 	s.pl[p] = pm
 
-	// Reorder the ordered priority list slice from back to front.
-	// This is most likely the most efficient algorithm.
-	s.opl = append(s.opl, pm)
-	for i := len(s.opl) - 1; i > 0; i-- {
-		if s.opl[i].priority < s.opl[i-1].priority {
-			s.opl[i] = s.opl[i-1]
-			s.opl[i-1] = pm
+	// Insert the priority into the ordered priority list at the position
+	// found by a binary search, shifting the higher priorities once.
+	i := sort.Search(len(s.opl), func(i int) bool {
+		if s.lowerFirst {
+			return s.opl[i].priority < p
 		}
+		return s.opl[i].priority > p
+	})
+	s.opl = append(s.opl, nil)
+	copy(s.opl[i+1:], s.opl[i:])
+	s.opl[i] = pm
+
+	if s.onInit != nil {
+		s.onInit(p, auto)
+	}
+	return true
+}
+
+// AddIf adds a new operation that only executes when shouldRun returns
+// true right before it's dispatched, e.g. because the work it would do may
+// become unnecessary while it's queued. Otherwise it's dropped with
+// DropCancelled and the next operation is dispatched instead, without using
+// up the rate. The predicate is called from within the main tick loop.
+func (s *Scheduler) AddIf(p Priority, o Operation, shouldRun func() bool) error {
+	return s.add(p, queuedOp{op: o, shouldRun: shouldRun}, false)
+}
+
+// AddAfter adds a new operation to the scheduler once d has passed, so it
+// doesn't become eligible for dispatch before the delay. Errors that occur
+// when the operation is added are passed to the OnError hook, unless the
+// scheduler has been stopped in the meantime.
+func (s *Scheduler) AddAfter(d time.Duration, p Priority, o Operation) {
+	time.AfterFunc(d, func() {
+		if err := s.Add(p, o); err != nil && err != ErrStopped {
+			s.handleError(err, 0)
+		}
+	})
+}
+
+// HasPriority returns whether the priority has been initialized.
+func (s *Scheduler) HasPriority(p Priority) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.pl[s.mapPriority(p)]
+	return ok
+}
+
+// Priorities returns the initialized priorities in the order in which they
+// are dispatched, so the most urgent priority comes first. The returned
+// slice is a copy.
+func (s *Scheduler) Priorities() []Priority {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ps := make([]Priority, len(s.opl))
+	// The ordered priority list is dispatched from the back.
+	for i, pm := range s.opl {
+		ps[len(s.opl)-1-i] = pm.priority
 	}
+	return ps
 }
 
 // Add adds a new operation to the scheduler.
 // The priority must be initialized unless automated initialization is enabled.
 func (s *Scheduler) Add(p Priority, o Operation) error {
+	return s.add(p, queuedOp{op: o}, false)
+}
+
+// AddFront adds a new operation to the front of its priority, so it's
+// executed before the operations that are already queued at the same
+// priority.
+func (s *Scheduler) AddFront(p Priority, o Operation) error {
+	return s.add(p, queuedOp{op: o}, true)
+}
+
+// AddAuto adds a new operation at the priority it declares by implementing
+// Prioritized. Other operations are added at the configured DefaultPriority,
+// or priority 0 when no default priority is configured.
+func (s *Scheduler) AddAuto(o Operation) error {
+	var p Priority
+	if po, ok := unwrap(o).(Prioritized); ok {
+		p = po.Priority()
+	} else if s.dp != nil {
+		p = *s.dp
+	}
+	return s.Add(p, o)
+}
+
+// add adds a queued operation to the back, or to the front, of a priority.
+// Operations that exceed the capacity are forwarded to the overflow
+// scheduler, if any.
+func (s *Scheduler) add(p Priority, q queuedOp, front bool) error {
+	_, err := s.addID(p, q, front, true)
+	return err
+}
+
+// readd adds an operation again from within its own execution. It never
+// waits for room inside the queue, because without workers only the tick
+// loop that executes the operation can make room.
+func (s *Scheduler) readd(p Priority, o Operation) error {
+	_, err := s.addID(p, queuedOp{op: o}, false, false)
+	return err
+}
+
+// addID adds a queued operation and returns its ID. The ID is 0 when the
+// operation was forwarded to the overflow scheduler. It only waits for room
+// when block is set and BlockOnFull is configured.
+func (s *Scheduler) addID(p Priority, q queuedOp, front, block bool) (OpID, error) {
+	id, evicted, err := s.enqueue(p, q, front)
+	if err == ErrMaxCapacity && block && s.blockOnFull {
+		var timeout <-chan time.Time
+		if s.addTimeout > 0 {
+			t := time.NewTimer(s.addTimeout)
+			defer t.Stop()
+			timeout = t.C
+		}
+		for err == ErrMaxCapacity && s.awaitCapacity(timeout) {
+			id, evicted, err = s.enqueue(p, q, front)
+		}
+	}
+	if err != ErrMaxCapacity && err != ErrPriorityCapacity {
+		s.drop(evicted, DropCapacity)
+		return id, err
+	}
+	reason := DropCapacity
+	if s.overflow != nil {
+		if err = s.overflow.add(p, q, front); err == nil {
+			return 0, nil
+		}
+		reason = DropOverflow
+	}
+	s.drop([]queuedOp{q}, reason)
+	return 0, err
+}
+
+// enqueue adds a queued operation to the queue of a priority.
+// When the priority is full and drops its oldest operation to make room,
+// the evicted operation is returned.
+func (s *Scheduler) enqueue(p Priority, q queuedOp, front bool) (OpID, []queuedOp, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.stopped {
+		return 0, nil, ErrStopped
+	}
+	if s.draining > 0 {
+		return 0, nil, ErrDraining
+	}
 	if s.curops >= s.maxops {
-		return ErrMaxCapacity
+		return 0, nil, ErrMaxCapacity
 	}
 
-	pm, err := s.getPriorityMetadata(p)
+	pm, err := s.enqueuePriority(s.mapPriority(p))
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
 
-	if err := pm.AddOperation(o); err != nil {
-		return err
+	var evicted []queuedOp
+	for pm.overflow == OverflowDropOldest && pm.full() && pm.curops > 0 {
+		old := pm.take(0)
+		if old.deadline > 0 {
+			s.deadlines--
+		}
+		s.curops--
+		evicted = append(evicted, old)
+	}
+
+	s.lastID++
+	q.id = s.lastID
+	q.enqueued = time.Now()
+	push := pm.push
+	if front {
+		push = pm.pushFront
+	}
+	if err := push(q); err != nil {
+		return 0, nil, err
 	}
 
+	if q.deadline > 0 {
+		s.deadlines++
+	}
 	s.curops++
+	if s.curops > s.peak {
+		s.peak = s.curops
+	}
+	s.notify(QueueEnqueue, pm)
+	if s.unlimited {
+		s.wakeUp()
+	}
+	return q.id, evicted, nil
+}
+
+// AddErr adds a new operation that can fail to the scheduler.
+// Errors returned by the operation are passed to the OnError hook, unless
+// the error is a RequeueError in which case the operation is added to the
+// same priority again.
+func (s *Scheduler) AddErr(p Priority, o ErrorOperation) error {
+	return s.Add(p, &errorOperation{s: s, p: p, o: o})
+}
+
+// errorOperation adapts an ErrorOperation to the Operation interface.
+type errorOperation struct {
+	s    *Scheduler
+	p    Priority
+	o    ErrorOperation
+	id   OpID        // The ID of the last dispatch.
+	done func(error) // Called when the operation is done, if any.
+}
+
+func (e *errorOperation) Execute() {
+	err := e.o.Execute()
+	if err == nil {
+		e.finish(nil)
+		return
+	}
+
+	var re *RequeueError
+	if !errors.As(err, &re) {
+		e.s.handleError(err, e.id)
+		e.finish(err)
+		return
+	}
+	if re.Delay <= 0 {
+		e.requeue()
+		return
+	}
+	time.AfterFunc(re.Delay, e.requeue)
+}
+
+func (e *errorOperation) finish(err error) {
+	if e.done != nil {
+		e.done(err)
+	}
+}
+
+func (e *errorOperation) identify(s *Scheduler, id OpID) {
+	e.s, e.id = s, id
+}
+
+func (e *errorOperation) unwrap() interface{} {
+	return e.o
+}
+
+func (e *errorOperation) requeue() {
+	if err := e.s.readd(e.p, e); err != nil && err != ErrStopped {
+		e.s.handleError(err, e.id)
+	}
+}
+
+// errorValue wraps errors so they can be stored inside an atomic.Value.
+type errorValue struct{ err error }
+
+// handleError stores the last error and passes it to the OnError hook,
+// together with the ID of the operation that caused it, if any.
+func (s *Scheduler) handleError(err error, id OpID) {
+	s.lastErr.Store(errorValue{err})
+	if s.onError != nil {
+		s.onError(err, id)
+	}
+}
+
+// RemoveFunc removes every pending operation for which pred returns true
+// and returns the amount of removed operations. The predicate receives the
+// operations as they were added, also when they were added using e.g.
+// AddWithCallback or AddReliable. The predicate is called while the
+// scheduler is locked and must not call back into the Scheduler.
+func (s *Scheduler) RemoveFunc(pred func(Operation) bool) int {
+	return s.removeFunc(func(q queuedOp) bool { return pred(added(q.op)) })
+}
+
+// removeFunc removes every queued operation for which pred returns true.
+func (s *Scheduler) removeFunc(pred func(queuedOp) bool) int {
+	var removed []queuedOp
+	s.mu.Lock()
+	for _, pm := range s.opl {
+		pm.removeFunc(func(q queuedOp) bool {
+			if !pred(q) {
+				return false
+			}
+			if q.deadline > 0 {
+				s.deadlines--
+			}
+			removed = append(removed, q)
+			return true
+		})
+	}
+	s.curops -= uint32(len(removed))
+	s.freeSpace()
+	s.mu.Unlock()
+
+	s.drop(removed, DropRemoved)
+	return len(removed)
+}
+
+// LastError returns the most recent error reported by the scheduler, or nil
+// when no error has occurred yet. It's recorded even when the OnError hook
+// isn't set, see Config.OnError for the sources of these errors.
+// This is a best-effort convenience, every error overwrites the previous one.
+func (s *Scheduler) LastError() error {
+	if v, ok := s.lastErr.Load().(errorValue); ok {
+		return v.err
+	}
 	return nil
 }
 
 // SetMinimumCallback sets a callback that will be executed each time
 // the amount of registered operations for a specific priority reaches
 // the specified minimum. Only one callback per priority can be set.
+// The callback isn't called while the scheduler is locked, so it can refill
+// the queue using Add.
 // This will fail when the priority is not initialized and automated
 // initialization is disabled.
 func (s *Scheduler) SetMinimumCallback(p Priority, minimum int, cb func(Priority)) error {
-	pm, err := s.getPriorityMetadata(p)
+	var ccb func(Priority, int)
+	if cb != nil {
+		ccb = func(p Priority, _ int) { cb(p) }
+	}
+	return s.SetMinimumCountCallback(p, minimum, ccb)
+}
+
+// SetMinimumCountCallback is like SetMinimumCallback but the callback also
+// receives the amount of operations of the priority at the moment it's
+// triggered. It replaces any callback set by SetMinimumCallback.
+func (s *Scheduler) SetMinimumCountCallback(p Priority, minimum int, cb func(Priority, int)) error {
+	s.mu.Lock()
+	pm, err := s.getPriorityMetadata(s.mapPriority(p))
 	if err != nil {
+		s.mu.Unlock()
 		return err
 	}
 
 	pm.Minimum = uint32(minimum)
 	pm.MinimumCallback = cb
-	if pm.Minimum >= pm.curops {
-		pm.MinimumCallback(pm.priority)
+	reached, n := cb != nil && pm.Minimum >= pm.curops, int(pm.curops)
+	s.mu.Unlock()
+
+	// The callback may refill the queue, so it's called without the lock.
+	if reached {
+		cb(pm.priority, n)
 	}
 	return nil
 }
 
+// mapPriority maps a requested priority onto the canonical priority using
+// the configured PriorityMapper.
+func (s *Scheduler) mapPriority(p Priority) Priority {
+	if s.pmap == nil {
+		return p
+	}
+	return s.pmap(p)
+}
+
 func (s *Scheduler) getPriorityMetadata(p Priority) (*priorityMetadata, error) {
+	if s.ps != nil && !s.ps.Contains(p) {
+		return nil, ErrInvalidPriority
+	}
 	pm, ok := s.pl[p]
 	if !ok {
 		if !s.pai {
 			return nil, ErrInvalidPriority
 		}
-		s.initPriority(p, s.pdc)
+		s.initPriority(p, s.pdc, true)
 		return s.pl[p], nil
 	}
 	return pm, nil
 }
 
+// enqueuePriority returns the priority new operations of priority p are
+// added to, which is the DefaultPriority when p isn't initialized.
+// The caller must hold the lock.
+func (s *Scheduler) enqueuePriority(p Priority) (*priorityMetadata, error) {
+	pm, err := s.getPriorityMetadata(p)
+	if err != ErrInvalidPriority || s.dp == nil || s.ps != nil && !s.ps.Contains(p) {
+		return pm, err
+	}
+	if pm, ok := s.pl[*s.dp]; ok {
+		return pm, nil
+	}
+	return nil, ErrInvalidPriority
+}
+
+// PendingPriority returns a snapshot of the operations that are currently
+// queued for the specified priority, in the order in which they will be
+// executed. The slice is a copy and is meant for inspection only.
+// It returns nil when the priority is not initialized.
+func (s *Scheduler) PendingPriority(p Priority) []Operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pm, ok := s.pl[s.mapPriority(p)]
+	if !ok {
+		return nil
+	}
+	return pm.Operations()
+}
+
 // Pause pauses the scheduler for the specified duration.
 // Use this when the rate limit has been exceeded and when you know
 // the moment where the next window will become active.
 func (s *Scheduler) Pause(d time.Duration) {
+	s.mu.Lock()
+	s.pauseFor(d)
+	s.mu.Unlock()
+}
+
+// pauseFor pauses the scheduler and returns the generation of the pause.
+// The caller must hold the lock.
+func (s *Scheduler) pauseFor(d time.Duration) uint64 {
+	if !time.Now().Before(s.pause) {
+		s.pauseDepth = s.curops
+	}
 	s.pause = time.Now().Add(d)
+	s.pauseGen++
+	return s.pauseGen
+}
+
+// PauseCtx pauses the scheduler for the specified duration, but resumes it
+// early when the context is done, e.g. when new information about the rate
+// limit becomes available. A later call to Pause or Resume takes precedence.
+func (s *Scheduler) PauseCtx(ctx context.Context, d time.Duration) {
+	s.mu.Lock()
+	gen := s.pauseFor(d)
+	s.mu.Unlock()
+
+	go func() {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			if s.pauseGen == gen {
+				s.resume()
+			}
+			s.mu.Unlock()
+		case <-t.C:
+		}
+	}()
+}
+
+// Resume ends an active pause of the scheduler.
+func (s *Scheduler) Resume() {
+	s.mu.Lock()
+	s.resume()
+	s.mu.Unlock()
+}
+
+// resume ends an active pause. The caller must hold the lock.
+func (s *Scheduler) resume() {
+	s.pause = time.Time{}
+	s.pauseGen++
+}
+
+// GrantPriorityCapacity temporarily raises the capacity of a priority by
+// extra operations for the specified duration, e.g. to accept a burst of
+// work without permanently raising the capacity. Operations that exceed the
+// capacity when the grant lapses remain queued. Priorities without a limit
+// aren't affected.
+func (s *Scheduler) GrantPriorityCapacity(p Priority, extra int, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pm, err := s.getPriorityMetadata(s.mapPriority(p))
+	if err != nil {
+		return err
+	}
+	if extra <= 0 {
+		return nil
+	}
+	pm.extra += uint32(extra)
+	time.AfterFunc(d, func() {
+		s.mu.Lock()
+		pm.extra -= uint32(extra)
+		s.mu.Unlock()
+	})
+	return nil
+}
+
+// PausePriority pauses the dispatch of the operations of a single priority
+// for the specified duration, while the other priorities keep running at the
+// rate of the scheduler. Use this when a rate limit of a specific resource
+// has been exceeded.
+func (s *Scheduler) PausePriority(p Priority, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pm, err := s.getPriorityMetadata(s.mapPriority(p))
+	if err != nil {
+		return err
+	}
+	pm.pause = time.Now().Add(d)
+	return nil
+}
+
+// SetRate changes the amount of operations per second of the scheduler.
+// A rate of 0 or less is treated as 1 operation per second.
+func (s *Scheduler) SetRate(ops float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.warmUp = 0
+	s.endBoost()
+	s.endReport()
+	s.setRate(Config{OPS: ops}.rate())
+}
+
+// BoostRate temporarily changes the amount of operations per second of the
+// scheduler, e.g. to clear a backlog after a traffic spike. After d the
+// previous rate is restored. Boosting again while a boost is active extends
+// it, using the new rate. SetRate ends the boost.
+func (s *Scheduler) BoostRate(ops float32, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := s.rate
+	if s.warmUp > 0 {
+		base = s.warmTarget
+		s.warmUp = 0
+	}
+	if s.boost != nil {
+		base = s.boostBase
+		s.endBoost()
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.boost == t && !s.stopped {
+			s.boost = nil
+			s.setRate(s.boostBase)
+		}
+	})
+	s.boost = t
+	s.boostBase = base
+	s.setRate(Config{OPS: ops}.rate())
+}
+
+// endBoost cancels an active boost without restoring the previous rate.
+// The caller must hold the lock.
+func (s *Scheduler) endBoost() {
+	if s.boost != nil {
+		s.boost.Stop()
+		s.boost = nil
+	}
+}
+
+// setRate changes the rate of the ticker. The caller must hold the lock.
+func (s *Scheduler) setRate(rate float32) {
+	if old := s.rate; old != rate && s.onRate != nil {
+		s.onRate(old, rate)
+	}
+	s.rate = rate
+	s.interval = interval(rate)
+	s.cfg.OPS = rate
+	s.ticker.Reset(s.interval)
+}
+
+// warmUpStart is the fraction of the rate the warm-up starts at.
+const warmUpStart = 0.1
+
+// warm adjusts the rate during the warm-up, which increases linearly from
+// a fraction of the configured rate to the configured rate.
+// The caller must hold the lock.
+func (s *Scheduler) warm(t time.Time) {
+	progress := float32(t.Sub(s.warmStart)) / float32(s.warmUp)
+	if progress >= 1 {
+		s.warmUp = 0
+		s.setRate(s.warmTarget)
+		return
+	}
+	if progress < warmUpStart {
+		progress = warmUpStart
+	}
+	s.setRate(s.warmTarget * progress)
+}
+
+// Config returns the currently effective configuration of the scheduler,
+// including the changes made at runtime by setters such as SetRate.
+func (s *Scheduler) Config() Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.cfg
+	c.OPS = s.rate
+	c.Workers = s.workers
+	return c
+}
+
+// SetExecutionBufferSize replaces the buffered channel that forwards
+// operations to the workers with a channel of capacity n. Operations that
+// are buffered inside the old channel are migrated to the new one, none of
+// them are lost. The workers are moved over to the new channel as well.
+// It has no effect when no workers are used.
+func (s *Scheduler) SetExecutionBufferSize(n int) {
+	if !s.usingWorkers {
+		return
+	}
+	if n <= 0 {
+		n = 1
+	}
+
+	s.qmu.Lock()
+	defer s.qmu.Unlock()
+	s.mu.Lock()
+	stopped := s.stopped
+	s.mu.Unlock()
+	if stopped {
+		return
+	}
+
+	// Start the new workers first so the migration can't block forever when
+	// the new channel is smaller than the amount of buffered operations.
+	old := s.opqueue
+	s.opqueue = make(chan Operation, n)
+	for i := 0; i < s.workers; i++ {
+		s.startWorker(s.opqueue, i)
+	}
+	s.mu.Lock()
+	s.cfg.ExecutionBufferSize = n
+	s.mu.Unlock()
+	for migrated := false; !migrated; {
+		select {
+		case o := <-old:
+			s.opqueue <- o
+		default:
+			migrated = true
+		}
+	}
+
+	// Closing the old channel makes the old workers return once they've
+	// finished their current operation.
+	close(old)
+}
+
+// waitPause blocks until the scheduler isn't paused anymore or until it
+// has been stopped.
+func (s *Scheduler) waitPause() {
+	for {
+		s.mu.Lock()
+		d := time.Until(s.pause)
+		s.mu.Unlock()
+		if d <= 0 {
+			return
+		}
+
+		select {
+		case <-time.After(d):
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// TakePriority removes and returns every pending operation of a priority in
+// FIFO order, e.g. to move them to another scheduler or to persist them.
+// Operations that were added using e.g. AddChunked or AddReliable are
+// returned wrapped, so they keep their behavior: once moved, they're added
+// again to the scheduler that dispatches them, at the priority they were
+// originally added at. It returns nil when the priority doesn't exist.
+func (s *Scheduler) TakePriority(p Priority) []Operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pm, ok := s.pl[s.mapPriority(p)]
+	if !ok {
+		return nil
+	}
+	ops := make([]Operation, 0, pm.curops)
+	for {
+		q, ok := pm.pop()
+		if !ok {
+			break
+		}
+		if q.deadline > 0 {
+			s.deadlines--
+		}
+		ops = append(ops, q.op)
+	}
+	s.curops -= uint32(len(ops))
+	s.freeSpace()
+	return ops
+}
+
+// takeAll removes and returns all pending operations in dispatch order,
+// regardless of the rate of their group.
+func (s *Scheduler) takeAll() []queuedOp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ops := make([]queuedOp, 0, s.curops)
+	for i := len(s.opl) - 1; i >= 0; i-- {
+		for {
+			q, ok := s.opl[i].pop()
+			if !ok {
+				break
+			}
+			ops = append(ops, q)
+		}
+	}
+	s.curops = 0
+	s.deadlines = 0
+	s.freeSpace()
+	return ops
 }
 
 // Stop stops the scheduler and all of it's background processes.
-// This might lead to skipping operations that are currently queued.
-// The operation is final. The scheduler shouldn't be used after
-// Stop has been called.
+// This might lead to skipping operations that are currently queued,
+// unless a DrainHandler is configured.
+// Operations that were already forwarded to the workers are executed before
+// Stop returns, after which the OnStop hook is called.
+// The scheduler shouldn't be used after Stop has been called, unless it's
+// reinitialized using Reset. Adding operations then fails with ErrStopped.
+// Calling Stop more than once is a no-op.
 func (s *Scheduler) Stop() {
-	s.ticker.Stop()
-	close(s.opqueue)
-	s.stop <- true
+	s.stopOnce.Do(func() {
+		s.ticker.Stop()
+		close(s.stop)
+		s.mu.Lock()
+		s.stopped = true
+		s.closeWatchers()
+		s.freeSpace()
+		s.mu.Unlock()
+
+		// Wait for the tick loop to return so that no operation is sent
+		// to the workers after the operation queue has been closed.
+		<-s.done
+		s.sources.Wait()
+		if s.drain != nil {
+			for _, q := range s.takeAll() {
+				s.drain(q.op)
+			}
+		} else {
+			s.drop(s.takeAll(), DropStopped)
+		}
+		s.qmu.Lock()
+		s.qclosed = true
+		if s.opqueue != nil {
+			close(s.opqueue)
+		}
+		s.qmu.Unlock()
+
+		// Let the workers finish the operations that were already forwarded.
+		s.wg.Wait()
+		if s.onStop != nil {
+			s.onStop()
+		}
+	})
 }
@@ -1,6 +1,15 @@
 package scheduler
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -15,7 +24,7 @@ func TestWorker(t *testing.T) {
 		close(ch)
 	}()
 
-	worker(ch)
+	(&Scheduler{}).worker(ch)
 }
 
 func TestNew(t *testing.T) {
@@ -83,17 +92,21 @@ func TestScheduler_getPriorityMetadata(t *testing.T) {
 
 func TestScheduler_InitPriority(t *testing.T) {
 	rl := New(Config{})
-	rl.InitPriority(10, 100)
-	if rl.opl[0].priority != 10 {
-		t.Fatal("wrong opl entry")
+	if !rl.InitPriority(10, 100) {
+		t.Fatal("priority should have been created")
+	}
+	if ps := rl.Priorities(); len(ps) != 1 || ps[0] != 10 {
+		t.Fatal("wrong priorities", ps)
 	}
 
 	rl.InitPriority(5, 100)
-	if rl.opl[0].priority != 5 || rl.opl[1].priority != 10 {
-		t.Fatal("wrong opl entry")
+	if ps := rl.Priorities(); len(ps) != 2 || ps[0] != 10 || ps[1] != 5 {
+		t.Fatal("wrong priorities", ps)
 	}
 
-	rl.InitPriority(5, 50)
+	if rl.InitPriority(5, 50) {
+		t.Fatal("priority should have been overwritten")
+	}
 	if rl.opl[0].maxops != 50 {
 		t.Fatal("wrong maxops entry")
 	}
@@ -116,3 +129,1561 @@ func TestSchedulerSetMinimumCallback(t *testing.T) {
 		t.Fatal("should have launched the minimum callback	")
 	}
 }
+
+func TestSchedulerSetMinimumCountCallback(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	for i := 0; i < 5; i++ {
+		rl.Add(1, &testOp{})
+	}
+
+	var counts []int
+	if err := rl.SetMinimumCountCallback(1, 2, func(p Priority, n int) {
+		counts = append(counts, n)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 0 {
+		t.Fatal("callback must not be triggered above the minimum")
+	}
+
+	for i := 0; i < 5; i++ {
+		rl.tick(time.Now())
+	}
+	if len(counts) != 1 || counts[0] != 2 {
+		t.Fatal("callback should receive the count at the trigger point", counts)
+	}
+
+	if err := rl.SetMinimumCountCallback(1, 3, func(p Priority, n int) {
+		counts = append(counts, n)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts[1] != 0 {
+		t.Fatal("callback should receive the current count when set below the minimum", counts)
+	}
+}
+
+func TestSchedulerMinimumCallbackRefill(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	refills := 0
+	refill := func(p Priority) {
+		refills++
+		rl.Add(p, &testOp{})
+	}
+	if err := rl.SetMinimumCallback(1, 0, refill); err != nil {
+		t.Fatal(err)
+	}
+	rl.tick(time.Now())
+	if refills != 2 || len(rl.PendingPriority(1)) != 1 {
+		t.Fatal("the callback should be able to refill the queue", refills)
+	}
+}
+
+func TestScheduler_PendingPriority(t *testing.T) {
+	rl := New(Config{})
+	if ops := rl.PendingPriority(1); ops != nil {
+		t.Fatal("expected nil for an uninitialized priority")
+	}
+
+	rl.InitPriority(1, 0)
+	o1, o2, o3 := &testOp{1}, &testOp{2}, &testOp{3}
+	for _, o := range []Operation{o1, o2, o3} {
+		if err := rl.Add(1, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ops := rl.PendingPriority(1)
+	if len(ops) != 3 || ops[0] != o1 || ops[1] != o2 || ops[2] != o3 {
+		t.Fatal("wrong pending operations", ops)
+	}
+
+	ops[0] = nil
+	if rl.PendingPriority(1)[0] != o1 {
+		t.Fatal("snapshot must not share state with the scheduler")
+	}
+}
+
+func TestScheduler_DefaultPriority(t *testing.T) {
+	o := &testOp{}
+	rl := New(Config{})
+	rl.InitPriority(1, 0)
+	if err := rl.Add(5, o); err != ErrInvalidPriority {
+		t.Fatal("expected ErrInvalidPriority without a default priority")
+	}
+
+	dp := Priority(1)
+	rl = New(Config{DefaultPriority: &dp})
+	if err := rl.Add(5, o); err != ErrInvalidPriority {
+		t.Fatal("expected ErrInvalidPriority for an uninitialized default priority")
+	}
+	rl.InitPriority(1, 0)
+	if err := rl.Add(5, o); err != nil {
+		t.Fatal(err)
+	}
+	if ops := rl.PendingPriority(1); len(ops) != 1 || ops[0] != o {
+		t.Fatal("operation should be added to the default priority")
+	}
+	if _, ok := rl.pl[5]; ok {
+		t.Fatal("the requested priority must not be initialized")
+	}
+	if err := rl.PausePriority(5, time.Minute); err != ErrInvalidPriority {
+		t.Fatal("the default priority only applies to new operations", err)
+	}
+	if err := rl.SetMinimumCallback(5, 1, func(Priority) {}); err != ErrInvalidPriority {
+		t.Fatal("the default priority only applies to new operations", err)
+	}
+}
+
+func TestScheduler_Stop(t *testing.T) {
+	for _, workers := range []int{0, 4} {
+		rl := New(Config{Workers: workers})
+		stopped := make(chan struct{})
+		go func() {
+			rl.Stop()
+			// The tick loop has already returned, this must not block.
+			rl.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("Stop blocked with", workers, "workers")
+		}
+		select {
+		case <-rl.done:
+		default:
+			t.Fatal("tick loop should have returned")
+		}
+	}
+}
+
+// benchmarkExecOp measures the hot path of a single tick at 10k OPS.
+// The internal ticker is stopped so that only the benchmark loop
+// dispatches operations.
+func benchmarkExecOp(b *testing.B, workers int) {
+	rl := New(Config{OPS: 10000, Workers: workers})
+	rl.ticker.Stop()
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+	o := &testOp{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rl.Add(1, o)
+		rl.execOp()
+	}
+}
+
+func BenchmarkScheduler_execOp(b *testing.B) {
+	benchmarkExecOp(b, 0)
+}
+
+func BenchmarkScheduler_execOpWorkers(b *testing.B) {
+	benchmarkExecOp(b, 4)
+}
+
+func TestSchedulerInitPriorityOrder(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	for _, p := range rand.New(rand.NewSource(1)).Perm(100) {
+		rl.InitPriority(Priority(p), 0)
+	}
+	for i, pm := range rl.opl {
+		if pm.priority != Priority(i) {
+			t.Fatal("ordered priority list is not sorted")
+		}
+	}
+}
+
+func BenchmarkScheduler_InitPriority(b *testing.B) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	perm := rand.New(rand.NewSource(1)).Perm(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		rl.pl = make(map[Priority]*priorityMetadata)
+		rl.opl = nil
+		b.StartTimer()
+		for _, p := range perm {
+			rl.InitPriority(Priority(p), 0)
+		}
+	}
+}
+
+func TestSchedulerOnPriorityInit(t *testing.T) {
+	inits := make(map[Priority]bool)
+	rl := New(Config{
+		PriorityAutoInit: true,
+		OnPriorityInit: func(p Priority, auto bool) {
+			inits[p] = auto
+		},
+	})
+
+	rl.InitPriority(1, 0)
+	if auto, ok := inits[1]; !ok || auto {
+		t.Fatal("explicit initialization should fire the hook with auto=false")
+	}
+
+	if err := rl.Add(2, &testOp{}); err != nil {
+		t.Fatal(err)
+	}
+	if auto, ok := inits[2]; !ok || !auto {
+		t.Fatal("automatic initialization should fire the hook with auto=true")
+	}
+
+	delete(inits, 1)
+	rl.InitPriority(1, 10)
+	if _, ok := inits[1]; ok {
+		t.Fatal("overwriting a priority must not fire the hook")
+	}
+}
+
+func TestSchedulerExecutor(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[Operation]int)
+	rl := New(Config{
+		OPS:     100,
+		Workers: 4,
+		Executor: func(o Operation) {
+			mu.Lock()
+			received[o]++
+			mu.Unlock()
+		},
+	})
+	defer rl.Stop()
+	if rl.usingWorkers {
+		t.Fatal("no workers should be started when an executor is set")
+	}
+
+	rl.InitPriority(1, 0)
+	ops := []Operation{&testOp{1}, &testOp{2}, &testOp{3}}
+	for _, o := range ops {
+		if err := rl.Add(1, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, o := range ops {
+		if received[o] != 1 {
+			t.Fatal("operation should be delivered exactly once, got", received[o])
+		}
+	}
+}
+
+func TestScheduler_AddErr(t *testing.T) {
+	errs := make(chan error, 10)
+	rl := New(Config{
+		OPS:     100,
+		OnError: func(err error, _ OpID) { errs <- err },
+	})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	executions := make(chan int, 10)
+	n := 0
+	if err := rl.AddErr(1, ClosureErr(func() error {
+		n++
+		executions <- n
+		switch n {
+		case 1:
+			return ErrRequeue
+		case 2:
+			return RequeueAfter(50 * time.Millisecond)
+		}
+		return errors.New("failed")
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case n := <-executions:
+			if n != i {
+				t.Fatal("wrong execution", n)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("operation should have been requeued")
+		}
+	}
+
+	select {
+	case err := <-errs:
+		if err.Error() != "failed" {
+			t.Fatal("wrong error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnError should have been called")
+	}
+	if len(errs) != 0 {
+		t.Fatal("requeue errors must not be passed to OnError")
+	}
+}
+
+func TestSchedulerMaxInFlight(t *testing.T) {
+	rl := New(Config{OPS: 200, Workers: 8, MaxInFlight: 2})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	var running, peak, done int32
+	for i := 0; i < 20; i++ {
+		rl.Add(1, Closure(func() {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(30 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&done, 1)
+		}))
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if p := atomic.LoadInt32(&peak); p != 2 {
+		t.Fatal("expected at most 2 operations in flight, got", p)
+	}
+	if atomic.LoadInt32(&done) < 10 {
+		t.Fatal("operations should keep being executed")
+	}
+}
+
+func TestSchedulerPauseHoldsBuffer(t *testing.T) {
+	rl := New(Config{
+		OPS:                 100,
+		Workers:             2,
+		ExecutionBufferSize: 5,
+		PauseHoldsBuffer:    true,
+	})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	// Occupy both workers so that the following operations are buffered.
+	block := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		rl.Add(1, Closure(func() { <-block }))
+	}
+	var mu sync.Mutex
+	var executed []time.Time
+	for i := 0; i < 5; i++ {
+		rl.Add(1, Closure(func() {
+			mu.Lock()
+			executed = append(executed, time.Now())
+			mu.Unlock()
+		}))
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	rl.Pause(300 * time.Millisecond)
+	resume := time.Now().Add(300 * time.Millisecond)
+	close(block)
+	time.Sleep(500 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(executed) != 5 {
+		t.Fatal("all operations should be executed after the pause, got", len(executed))
+	}
+	for _, e := range executed {
+		if e.Before(resume) {
+			t.Fatal("operation was executed during a pause")
+		}
+	}
+}
+
+func TestSchedulerOnErrorID(t *testing.T) {
+	var ids []OpID
+	rl := newManual(Config{OnError: func(_ error, id OpID) { ids = append(ids, id) }})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	// IDs are assigned in order, so the failing operation receives the next.
+	id, _ := rl.AddID(1, &testOp{})
+	rl.AddErr(1, ClosureErr(func() error { return errors.New("failed") }))
+	for i := 0; i < 2; i++ {
+		rl.tick(time.Now())
+	}
+	if len(ids) != 1 || ids[0] != id+1 {
+		t.Fatal("OnError should receive the ID of the failed operation", id, ids)
+	}
+}
+
+func TestScheduler_LastError(t *testing.T) {
+	rl := New(Config{OPS: 100})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	if rl.LastError() != nil {
+		t.Fatal("there should be no error yet")
+	}
+
+	err1, err2 := errors.New("first"), errors.New("second")
+	rl.AddErr(1, ClosureErr(func() error { return err1 }))
+	rl.AddErr(1, ClosureErr(func() error { return nil }))
+	rl.AddErr(1, ClosureErr(func() error { return err2 }))
+	time.Sleep(100 * time.Millisecond)
+
+	if rl.LastError() != err2 {
+		t.Fatal("expected the latest error, got", rl.LastError())
+	}
+}
+
+func TestSchedulerPriorityMapper(t *testing.T) {
+	rl := New(Config{
+		PriorityMapper: func(p Priority) Priority {
+			if p >= 100 {
+				return p / 100
+			}
+			return p
+		},
+	})
+	rl.InitPriority(1, 0)
+	if _, ok := rl.pl[100]; ok {
+		t.Fatal("mapped priorities must not be initialized")
+	}
+
+	o := &testOp{}
+	if err := rl.Add(100, o); err != nil {
+		t.Fatal(err)
+	}
+	if ops := rl.PendingPriority(1); len(ops) != 1 || ops[0] != o {
+		t.Fatal("operation should land in the target priority")
+	}
+	if ops := rl.PendingPriority(100); len(ops) != 1 {
+		t.Fatal("PendingPriority should map the priority as well")
+	}
+
+	if rl.InitPriority(200, 0) != true || rl.InitPriority(2, 0) != false {
+		t.Fatal("InitPriority should map the priority")
+	}
+}
+
+// newManual creates a scheduler whose ticks are driven by the test through
+// the tick method instead of the internal ticker.
+func newManual(c Config) *Scheduler {
+	s := New(c)
+	s.ticker.Stop()
+	return s
+}
+
+func TestSchedulerOneOperationPerTick(t *testing.T) {
+	var executed, fallbacks int
+	rl := newManual(Config{
+		Fallback: Closure(func() { fallbacks++ }),
+	})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	for i := 0; i < 5; i++ {
+		rl.Add(1, Closure(func() { executed++ }))
+	}
+
+	for i := 1; i <= 7; i++ {
+		rl.tick(time.Now())
+		wantExecuted, wantFallbacks := i, 0
+		if i > 5 {
+			wantExecuted, wantFallbacks = 5, i-5
+		}
+		if executed != wantExecuted || fallbacks != wantFallbacks {
+			t.Fatal("wrong executions after", i, "ticks:", executed, fallbacks)
+		}
+	}
+
+	rl.Pause(time.Hour)
+	rl.Add(1, Closure(func() { executed++ }))
+	rl.tick(time.Now())
+	if executed != 5 || fallbacks != 2 {
+		t.Fatal("a paused tick must not execute anything")
+	}
+}
+
+func TestSchedulerConcurrentAdd(t *testing.T) {
+	var executed int32
+	rl := New(Config{OPS: 2000, Workers: 4})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(p Priority) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := rl.Add(p, Closure(func() { atomic.AddInt32(&executed, 1) })); err != nil {
+					t.Error(err)
+				}
+			}
+		}(Priority(g%2 + 1))
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&executed) != 400 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected 400 executed operations, got", atomic.LoadInt32(&executed))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if h := rl.Health(); h.QueueDepth != 0 {
+		t.Fatal("queue should be empty", h.QueueDepth)
+	}
+}
+
+func TestSchedulerPauseDuringDispatch(t *testing.T) {
+	var executed int32
+	rl := New(Config{OPS: 1000, Workers: 2})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				rl.Pause(time.Millisecond)
+				rl.Health()
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			rl.Add(1, Closure(func() { atomic.AddInt32(&executed, 1) }))
+		}
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&executed) != 100 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected 100 executed operations, got", atomic.LoadInt32(&executed))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSchedulerStopMidFlight(t *testing.T) {
+	for _, workers := range []int{0, 4} {
+		rl := New(Config{OPS: 1000, Workers: workers})
+		rl.InitPriority(1, 0)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				rl.Add(1, Closure(func() { time.Sleep(time.Millisecond) }))
+			}
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		stopped := make(chan struct{})
+		go func() {
+			rl.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("Stop blocked with", workers, "workers")
+		}
+		wg.Wait()
+	}
+}
+
+func TestScheduler_SetExecutionBufferSize(t *testing.T) {
+	rl := newManual(Config{Workers: 2, ExecutionBufferSize: 10})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	// Occupy both workers so the remaining operations stay buffered.
+	block := make(chan struct{})
+	var executed int32
+	for i := 0; i < 2; i++ {
+		rl.Add(1, Closure(func() {
+			<-block
+			atomic.AddInt32(&executed, 1)
+		}))
+	}
+	for i := 0; i < 10; i++ {
+		rl.Add(1, Closure(func() { atomic.AddInt32(&executed, 1) }))
+	}
+	for i := 0; i < 12; i++ {
+		rl.execOp()
+	}
+
+	rl.SetExecutionBufferSize(3)
+	if cap(rl.opqueue) != 3 {
+		t.Fatal("wrong buffer size", cap(rl.opqueue))
+	}
+	close(block)
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&executed) != 12 {
+		if time.Now().After(deadline) {
+			t.Fatal("operations were lost during the resize, executed", atomic.LoadInt32(&executed))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSchedulerOnStop(t *testing.T) {
+	var last, stopped int32
+	rl := newManual(Config{
+		Workers:             2,
+		ExecutionBufferSize: 4,
+		OnStop: func() {
+			if atomic.LoadInt32(&last) != 1 {
+				t.Error("OnStop was called before the last operation finished")
+			}
+			atomic.AddInt32(&stopped, 1)
+		},
+	})
+	rl.InitPriority(1, 0)
+	rl.Add(1, Closure(func() {
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&last, 1)
+	}))
+	rl.execOp()
+
+	rl.Stop()
+	rl.Stop()
+	if atomic.LoadInt32(&stopped) != 1 {
+		t.Fatal("OnStop should be called exactly once")
+	}
+}
+
+func TestSchedulerOnTick(t *testing.T) {
+	var ticks, executed int
+	rl := newManual(Config{
+		Fallback: Closure(func() {}),
+		OnTick: func(e bool) {
+			ticks++
+			if e {
+				executed++
+			}
+		},
+	})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	for i := 0; i < 3; i++ {
+		rl.Add(1, &testOp{})
+	}
+
+	for i := 0; i < 10; i++ {
+		rl.tick(time.Now())
+	}
+	if ticks != 10 || executed != 3 {
+		t.Fatal("expected 10 ticks of which 3 executed, got", ticks, executed)
+	}
+}
+
+func TestScheduler_RemoveFunc(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+	for i := 0; i < 10; i++ {
+		rl.Add(Priority(i%2+1), &testOp{i})
+	}
+
+	removed := rl.RemoveFunc(func(o Operation) bool {
+		op, ok := o.(*testOp)
+		return ok && op.T%3 == 0
+	})
+	if removed != 4 {
+		t.Fatal("expected 4 removed operations, got", removed)
+	}
+	if h := rl.Health(); h.QueueDepth != 6 {
+		t.Fatal("wrong queue depth", h.QueueDepth)
+	}
+
+	want := map[Priority][]int{1: {2, 4, 8}, 2: {1, 5, 7}}
+	for p, ts := range want {
+		ops := rl.PendingPriority(p)
+		if len(ops) != len(ts) {
+			t.Fatal("wrong amount of operations for priority", p)
+		}
+		for i, o := range ops {
+			if o.(*testOp).T != ts[i] {
+				t.Fatal("wrong remaining operations for priority", p)
+			}
+		}
+	}
+}
+
+func TestScheduler_RemoveFuncWrapped(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	var dropped error
+	rl.Add(1, &testOp{1})
+	rl.AddWithCallback(1, &testOp{1}, func(err error) { dropped = err })
+	rl.AddReliable(1, &testOp{1}, 1)
+	rl.Add(1, &testOp{2})
+
+	removed := rl.RemoveFunc(func(o Operation) bool {
+		op, ok := o.(*testOp)
+		return ok && op.T == 1
+	})
+	if removed != 3 {
+		t.Fatal("wrapped operations should be passed as they were added", removed)
+	}
+	if de, ok := dropped.(*DropError); !ok || de.Reason != DropRemoved {
+		t.Fatal("the callback should receive the removal", dropped)
+	}
+}
+
+func TestSchedulerDispatchOrder(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	var order []string
+	add := func(p Priority, name string) {
+		rl.Add(p, Closure(func() { order = append(order, name) }))
+	}
+	add(1, "A")
+	add(2, "B")
+	add(1, "C")
+
+	for i := 0; i < 3; i++ {
+		rl.tick(time.Now())
+	}
+	if len(order) != 3 || order[0] != "B" || order[1] != "A" || order[2] != "C" {
+		t.Fatal("expected dispatch order B, A, C, got", order)
+	}
+}
+
+func TestScheduler_Reset(t *testing.T) {
+	rl := New(Config{OPS: 50})
+	rl.InitPriority(1, 0)
+	rl.Add(1, &testOp{})
+	if err := rl.Reset(Config{}); err != ErrNotStopped {
+		t.Fatal("expected ErrNotStopped")
+	}
+
+	rl.Stop()
+	if err := rl.Reset(Config{OPS: 100, Workers: 2}); err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Stop()
+	if h := rl.Health(); h.Status != StatusRunning || h.QueueDepth != 0 || h.Rate != 100 || h.Workers != 2 {
+		t.Fatal("wrong health after reset", h)
+	}
+
+	done := make(chan struct{})
+	rl.InitPriority(1, 0)
+	if err := rl.Add(1, Closure(func() { close(done) })); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("operation should be executed after a reset")
+	}
+}
+
+func TestSchedulerDrainHandler(t *testing.T) {
+	var drained []Operation
+	rl := newManual(Config{
+		DrainHandler: func(o Operation) { drained = append(drained, o) },
+	})
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+	o1, o2, o3 := &testOp{1}, &testOp{2}, &testOp{3}
+	rl.Add(1, o1)
+	rl.Add(2, o2)
+	rl.Add(1, o3)
+
+	rl.Stop()
+	if len(drained) != 3 || drained[0] != o2 || drained[1] != o1 || drained[2] != o3 {
+		t.Fatal("all pending operations should be drained in dispatch order", drained)
+	}
+	if h := rl.Health(); h.QueueDepth != 0 {
+		t.Fatal("queue should be empty after draining")
+	}
+}
+
+func TestScheduler_Config(t *testing.T) {
+	rl := New(Config{OPS: 5, Workers: 2, MaxQueueSize: 10, ExecutionBufferSize: 3})
+	defer rl.Stop()
+
+	c := rl.Config()
+	if c.OPS != 5 || c.Workers != 2 || c.MaxQueueSize != 10 || c.ExecutionBufferSize != 3 {
+		t.Fatal("wrong configuration", c)
+	}
+
+	rl.SetRate(20)
+	rl.SetExecutionBufferSize(6)
+	c = rl.Config()
+	if c.OPS != 20 || c.ExecutionBufferSize != 6 {
+		t.Fatal("configuration should reflect runtime changes", c)
+	}
+	if h := rl.Health(); h.Rate != 20 {
+		t.Fatal("wrong rate", h.Rate)
+	}
+}
+
+func TestScheduler_SetRate(t *testing.T) {
+	var ticks int32
+	rl := New(Config{OPS: 1, OnTick: func(bool) { atomic.AddInt32(&ticks, 1) }})
+	defer rl.Stop()
+
+	rl.SetRate(50)
+	time.Sleep(500 * time.Millisecond)
+	if n := atomic.LoadInt32(&ticks); n < 15 || n > 30 {
+		t.Fatal("expected about 25 ticks at the new rate, got", n)
+	}
+}
+
+func TestSchedulerOnRateChange(t *testing.T) {
+	var changes [][2]float32
+	rl := New(Config{OPS: 10, OnRateChange: func(old, new float32) {
+		changes = append(changes, [2]float32{old, new})
+	}})
+	defer rl.Stop()
+
+	rl.SetRate(20)
+	rl.SetRate(20)
+	if len(changes) != 1 || changes[0] != [2]float32{10, 20} {
+		t.Fatal("OnRateChange should receive the old and new rate once", changes)
+	}
+}
+
+func TestSchedulerMinInterval(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	rl := New(Config{OPS: 200, MinInterval: 20 * time.Millisecond})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	for i := 0; i < 20; i++ {
+		rl.Add(1, Closure(func() {
+			mu.Lock()
+			times = append(times, time.Now())
+			mu.Unlock()
+		}))
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(times) < 4 || len(times) > 8 {
+		t.Fatal("dispatches should be paced by MinInterval", len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[i-1]); d < 20*time.Millisecond {
+			t.Fatal("dispatches must not be closer than MinInterval", d)
+		}
+	}
+}
+
+func TestSchedulerMiddleware(t *testing.T) {
+	var trace []string
+	wrap := func(name string) func(Operation) Operation {
+		return func(o Operation) Operation {
+			return Closure(func() {
+				trace = append(trace, name)
+				o.Execute()
+			})
+		}
+	}
+	rl := newManual(Config{Middleware: []func(Operation) Operation{wrap("inner"), wrap("outer")}})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	executed := 0
+	for i := 0; i < 3; i++ {
+		rl.Add(1, Closure(func() {
+			executed++
+			trace = append(trace, "op")
+		}))
+	}
+	if ops := rl.PendingPriority(1); len(ops) != 3 {
+		t.Fatal("queued operations must not be wrapped")
+	}
+	for i := 0; i < 3; i++ {
+		rl.tick(time.Now())
+	}
+
+	if executed != 3 || len(trace) != 9 {
+		t.Fatal("middleware should run for every executed operation", trace)
+	}
+	if trace[0] != "outer" || trace[1] != "inner" || trace[2] != "op" {
+		t.Fatal("middleware should be applied in order", trace)
+	}
+}
+
+func TestSchedulerDryRun(t *testing.T) {
+	var dry []Operation
+	rl := newManual(Config{DryRun: true, OnDryRun: func(o Operation) {
+		dry = append(dry, o)
+	}})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	executed := 0
+	for i := 0; i < 3; i++ {
+		rl.Add(1, Closure(func() { executed++ }))
+	}
+	for i := 0; i < 3; i++ {
+		rl.tick(time.Now())
+		if len(dry) != i+1 {
+			t.Fatal("OnDryRun should be called once per tick", len(dry))
+		}
+	}
+	if executed != 0 {
+		t.Fatal("operations must not be executed during a dry run")
+	}
+	if rl.Stats().Dispatched != 3 || len(rl.PendingPriority(1)) != 0 {
+		t.Fatal("counters should behave as if the operations ran")
+	}
+}
+
+func TestSchedulerWorkerLabels(t *testing.T) {
+	rl := New(Config{Workers: 3, WorkerLabelPrefix: "test-worker-"})
+	defer rl.Stop()
+	time.Sleep(10 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		label := fmt.Sprintf(`"worker":"test-worker-%d"`, i)
+		if !strings.Contains(buf.String(), label) {
+			t.Fatal("missing worker label", label)
+		}
+	}
+}
+
+func TestScheduler_AddFront(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	var order []int
+	add := func(i int) Operation {
+		return Closure(func() { order = append(order, i) })
+	}
+	rl.Add(1, add(1))
+	rl.Add(1, add(2))
+	rl.Add(2, add(3))
+	if err := rl.AddFront(1, add(4)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		rl.tick(time.Now())
+	}
+	want := []int{3, 4, 1, 2}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatal("expected order", want, "got", order)
+		}
+	}
+}
+
+func TestSchedulerOnLag(t *testing.T) {
+	lags := make(chan time.Duration, 10)
+	rl := New(Config{
+		OPS:   20,
+		OnLag: func(lag time.Duration) { lags <- lag },
+	})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	time.Sleep(200 * time.Millisecond)
+	if len(lags) != 0 {
+		t.Fatal("no lag should be reported without slow operations")
+	}
+
+	rl.Add(1, Closure(func() { time.Sleep(200 * time.Millisecond) }))
+	select {
+	case lag := <-lags:
+		if lag < 100*time.Millisecond {
+			t.Fatal("lag is too small", lag)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the lag hook should have fired")
+	}
+}
+
+func TestSchedulerWarmUp(t *testing.T) {
+	var mu sync.Mutex
+	var ticks []time.Time
+	rl := New(Config{
+		OPS:    20,
+		WarmUp: time.Second,
+		OnTick: func(bool) {
+			mu.Lock()
+			ticks = append(ticks, time.Now())
+			mu.Unlock()
+		},
+	})
+	start := time.Now()
+	time.Sleep(1500 * time.Millisecond)
+	rl.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ticks) < 10 {
+		t.Fatal("not enough ticks", len(ticks))
+	}
+	if first := ticks[0].Sub(start); first < 400*time.Millisecond {
+		t.Fatal("the first tick should be slow during the warm-up", first)
+	}
+	if last := ticks[len(ticks)-1].Sub(ticks[len(ticks)-2]); last > 70*time.Millisecond {
+		t.Fatal("ticks should be at full rate after the warm-up", last)
+	}
+	if rl.Config().OPS != 20 {
+		t.Fatal("the rate should be restored after the warm-up")
+	}
+}
+
+func TestSchedulerOnBufferFull(t *testing.T) {
+	var full int32
+	rl := newManual(Config{
+		Workers:             1,
+		ExecutionBufferSize: 1,
+		OnBufferFull:        func() { atomic.AddInt32(&full, 1) },
+	})
+	rl.InitPriority(1, 0)
+
+	// Stall the worker so the buffer fills up.
+	release := make(chan struct{})
+	started := make(chan struct{})
+	rl.Add(1, Closure(func() {
+		close(started)
+		<-release
+	}))
+	rl.Add(1, &testOp{})
+	rl.Add(1, &testOp{})
+	rl.tick(time.Now())
+	<-started
+	rl.tick(time.Now())
+	if atomic.LoadInt32(&full) != 0 {
+		t.Fatal("hook fired before the buffer was full")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	rl.tick(time.Now())
+	if atomic.LoadInt32(&full) != 1 {
+		t.Fatal("hook should fire when the buffer is full")
+	}
+	rl.Stop()
+}
+
+func TestSchedulerOverflow(t *testing.T) {
+	overflow := newManual(Config{PriorityAutoInit: true})
+	defer overflow.Stop()
+	rl := newManual(Config{MaxQueueSize: 2, PriorityAutoInit: true, Overflow: overflow})
+	defer rl.Stop()
+
+	var executed int32
+	for i := 0; i < 5; i++ {
+		err := rl.Add(1, Closure(func() { atomic.AddInt32(&executed, 1) }))
+		if err != nil {
+			t.Fatal("overflowing operation should be accepted", err)
+		}
+	}
+	if rl.curops != 2 || overflow.curops != 3 {
+		t.Fatal("operations beyond the capacity should overflow", rl.curops, overflow.curops)
+	}
+	for i := 0; i < 3; i++ {
+		rl.tick(time.Now())
+		overflow.tick(time.Now())
+	}
+	if atomic.LoadInt32(&executed) != 5 {
+		t.Fatal("not every operation executed", executed)
+	}
+}
+
+func TestSchedulerExecuteNow(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	queued, urgent := false, false
+	rl.Add(1, Closure(func() { queued = true }))
+
+	rl.ExecuteNow(Closure(func() { urgent = true }))
+	if !urgent {
+		t.Fatal("operation should execute immediately")
+	}
+
+	// The next tick compensates for the urgent operation.
+	rl.tick(time.Now())
+	if queued {
+		t.Fatal("the next tick should be skipped")
+	}
+	rl.tick(time.Now())
+	if !queued {
+		t.Fatal("the queued operation should execute afterwards")
+	}
+}
+
+type prioritizedOp struct {
+	testOp
+	p Priority
+}
+
+func (o *prioritizedOp) Priority() Priority { return o.p }
+
+func TestScheduler_AddAuto(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(0, 0)
+	rl.InitPriority(3, 0)
+
+	if err := rl.AddAuto(&prioritizedOp{p: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.AddAuto(&testOp{}); err != nil {
+		t.Fatal(err)
+	}
+	if rl.pl[3].curops != 1 || rl.pl[0].curops != 1 {
+		t.Fatal("operations should be added at the priority they declare")
+	}
+	if err := rl.AddAuto(&prioritizedOp{p: 5}); err != ErrInvalidPriority {
+		t.Fatal("declared priority must be initialized", err)
+	}
+}
+
+func TestSchedulerPriorityBuffers(t *testing.T) {
+	rl := newManual(Config{Workers: 1, ExecutionBufferSize: 5, PriorityBuffers: true})
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []int
+	record := func(i int) Operation {
+		return Closure(func() {
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		})
+	}
+
+	rl.Add(1, Closure(func() { <-release }))
+	rl.tick(time.Now())
+	rl.Add(1, record(1))
+	rl.Add(1, record(2))
+	rl.tick(time.Now())
+	rl.tick(time.Now())
+	rl.Add(2, record(3))
+	rl.tick(time.Now())
+
+	close(release)
+	rl.Stop()
+	if len(order) != 3 || order[0] != 3 || order[1] != 1 || order[2] != 2 {
+		t.Fatal("high priority should execute first at the worker level", order)
+	}
+}
+
+func TestSchedulerPriorityBuffersLowerFirst(t *testing.T) {
+	rl := newManual(Config{Workers: 1, ExecutionBufferSize: 5, PriorityBuffers: true, PriorityOrder: LowerFirst})
+	rl.InitPriority(1, 0)
+	rl.InitPriority(9, 0)
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []Priority
+	record := func(p Priority) Operation {
+		return Closure(func() {
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+		})
+	}
+
+	rl.Add(1, Closure(func() { <-release }))
+	rl.tick(time.Now())
+	rl.Add(9, record(9))
+	rl.tick(time.Now())
+	rl.Add(1, record(1))
+	rl.tick(time.Now())
+
+	close(release)
+	rl.Stop()
+	if len(order) != 2 || order[0] != 1 || order[1] != 9 {
+		t.Fatal("the buffer should follow the priority order", order)
+	}
+}
+
+func TestSchedulerBoostRate(t *testing.T) {
+	rl := newManual(Config{OPS: 10})
+	defer rl.Stop()
+
+	rl.BoostRate(100, 50*time.Millisecond)
+	if rl.Config().OPS != 100 {
+		t.Fatal("rate should be elevated during the boost")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if rl.Config().OPS != 10 {
+		t.Fatal("rate should be restored after the boost", rl.Config().OPS)
+	}
+
+	rl.BoostRate(100, 50*time.Millisecond)
+	rl.SetRate(20)
+	time.Sleep(100 * time.Millisecond)
+	if rl.Config().OPS != 20 {
+		t.Fatal("SetRate should end the boost", rl.Config().OPS)
+	}
+}
+
+func TestSchedulerReportRemaining(t *testing.T) {
+	rl := newManual(Config{OPS: 100})
+	defer rl.Stop()
+
+	rl.ReportRemaining(5, time.Now().Add(time.Second))
+	if ops := rl.Config().OPS; ops < 4.9 || ops > 5.1 {
+		t.Fatal("the remaining requests should be spread until the reset", ops)
+	}
+	rl.ReportRemaining(1000, time.Now().Add(time.Second))
+	if ops := rl.Config().OPS; ops != 100 {
+		t.Fatal("a report must not raise the rate above the previous rate", ops)
+	}
+	rl.ReportRemaining(0, time.Now().Add(50*time.Millisecond))
+	if rl.Health().Status != StatusPaused {
+		t.Fatal("the scheduler should pause when no requests remain")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if ops := rl.Config().OPS; ops != 100 || rl.Health().Status != StatusRunning {
+		t.Fatal("the rate should be restored after the reset", ops)
+	}
+}
+
+func TestSchedulerPausePriority(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	var order []Priority
+	for i := 0; i < 2; i++ {
+		rl.Add(2, Closure(func() { order = append(order, 2) }))
+		rl.Add(1, Closure(func() { order = append(order, 1) }))
+	}
+	if err := rl.PausePriority(2, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	rl.tick(time.Now())
+	rl.tick(time.Now())
+	if len(order) != 2 || order[0] != 1 || order[1] != 1 {
+		t.Fatal("other priorities should keep running", order)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	rl.tick(time.Now())
+	if len(order) != 3 || order[2] != 2 {
+		t.Fatal("the priority should resume after the pause", order)
+	}
+}
+
+func TestScheduler_HasPriority(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	if rl.HasPriority(1) {
+		t.Fatal("priority shouldn't exist before InitPriority")
+	}
+	rl.InitPriority(1, 0)
+	if !rl.HasPriority(1) || rl.HasPriority(2) {
+		t.Fatal("only initialized priorities should exist")
+	}
+}
+
+func TestSchedulerBlockOnFull(t *testing.T) {
+	rl := newManual(Config{MaxQueueSize: 1, PriorityAutoInit: true})
+	rl.Add(1, &testOp{})
+	if err := rl.Add(1, &testOp{}); err != ErrMaxCapacity {
+		t.Fatal("Add shouldn't block by default", err)
+	}
+	rl.Stop()
+
+	rl = newManual(Config{MaxQueueSize: 1, PriorityAutoInit: true, BlockOnFull: true})
+	defer rl.Stop()
+	rl.Add(1, &testOp{})
+	done := make(chan error)
+	go func() { done <- rl.Add(1, &testOp{}) }()
+	select {
+	case err := <-done:
+		t.Fatal("Add should block while the queue is full", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	rl.tick(time.Now())
+	if err := <-done; err != nil {
+		t.Fatal("Add should succeed once there's room", err)
+	}
+
+}
+
+func TestSchedulerBlockOnFullReadd(t *testing.T) {
+	var errs []error
+	rl := newManual(Config{
+		MaxQueueSize:     1,
+		PriorityAutoInit: true,
+		BlockOnFull:      true,
+		OnError:          func(err error, _ OpID) { errs = append(errs, err) },
+	})
+	defer rl.Stop()
+
+	// Another producer takes the room freed by dispatching the chunk.
+	rl.AddChunked(1, ClosureChunked(func() bool {
+		rl.Add(1, &testOp{})
+		return true
+	}))
+	done := make(chan struct{})
+	go func() {
+		rl.tick(time.Now())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the tick loop shouldn't wait for room to add the chunk again")
+	}
+	if len(errs) != 1 || errs[0] != ErrMaxCapacity {
+		t.Fatal("the full queue should be reported", errs)
+	}
+}
+
+func TestSchedulerAddTimeout(t *testing.T) {
+	rl := newManual(Config{
+		MaxQueueSize:     1,
+		PriorityAutoInit: true,
+		BlockOnFull:      true,
+		AddTimeout:       10 * time.Millisecond,
+	})
+	defer rl.Stop()
+	rl.Add(1, &testOp{})
+	if err := rl.Add(1, &testOp{}); err != ErrMaxCapacity {
+		t.Fatal("Add should give up after the timeout", err)
+	}
+}
+
+func TestSchedulerPauseCtx(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	executed := false
+	rl.Add(1, Closure(func() { executed = true }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rl.PauseCtx(ctx, time.Minute)
+	rl.tick(time.Now())
+	if executed {
+		t.Fatal("operation executed during the pause")
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for !executed {
+		if time.Now().After(deadline) {
+			t.Fatal("cancelling the context should resume the scheduler")
+		}
+		time.Sleep(time.Millisecond)
+		rl.tick(time.Now())
+	}
+}
+
+func TestSchedulerResume(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	executed := false
+	rl.Add(1, Closure(func() { executed = true }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rl.PauseCtx(ctx, time.Minute)
+	rl.Resume()
+	rl.Pause(time.Minute)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	rl.tick(time.Now())
+	if executed {
+		t.Fatal("a later pause shouldn't be cut short by an earlier context")
+	}
+	rl.Resume()
+	rl.tick(time.Now())
+	if !executed {
+		t.Fatal("Resume should end the pause")
+	}
+}
+
+func TestSchedulerOnSyncBlock(t *testing.T) {
+	var blocked time.Duration
+	rl := newManual(Config{OPS: 100, OnSyncBlock: func(d time.Duration) { blocked = d }})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	rl.Add(1, &testOp{})
+	rl.tick(time.Now())
+	if blocked != 0 {
+		t.Fatal("fast operations shouldn't fire the hook")
+	}
+	rl.Add(1, Closure(func() { time.Sleep(20 * time.Millisecond) }))
+	rl.tick(time.Now())
+	if blocked < 20*time.Millisecond {
+		t.Fatal("slow synchronous operation should fire the hook", blocked)
+	}
+}
+
+func TestSchedulerAddAfter(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	var executed int32
+	rl.AddAfter(50*time.Millisecond, 1, Closure(func() { atomic.AddInt32(&executed, 1) }))
+
+	rl.tick(time.Now())
+	time.Sleep(20 * time.Millisecond)
+	rl.tick(time.Now())
+	if atomic.LoadInt32(&executed) != 0 {
+		t.Fatal("operation shouldn't run before the delay")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	rl.tick(time.Now())
+	if atomic.LoadInt32(&executed) != 1 {
+		t.Fatal("operation should run after the delay")
+	}
+}
+
+func TestSchedulerAddIf(t *testing.T) {
+	var reasons []DropReason
+	rl := newManual(Config{OnDrop: func(o Operation, r DropReason, _ OpID) { reasons = append(reasons, r) }})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	var executed []int
+	rl.AddIf(1, Closure(func() { executed = append(executed, 1) }), func() bool { return false })
+	rl.AddIf(1, Closure(func() { executed = append(executed, 2) }), func() bool { return true })
+	rl.tick(time.Now())
+
+	if len(executed) != 1 || executed[0] != 2 {
+		t.Fatal("the next operation should run instead", executed)
+	}
+	if len(reasons) != 1 || reasons[0] != DropCancelled {
+		t.Fatal("skipped operation should be dropped as cancelled", reasons)
+	}
+}
+
+func TestSchedulerAddIfAccounting(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	rl.AddIf(1, &testOp{}, func() bool { return false })
+	rl.AddIf(1, &testOp{}, func() bool { return true })
+	rl.tick(time.Now())
+	if st := rl.Stats(); st.Dispatched != 1 || rl.PriorityRate(1) != 0.1 {
+		t.Fatal("a cancelled operation must not count as dispatched", st.Dispatched, rl.PriorityRate(1))
+	}
+}
+
+func TestSchedulerGrantPriorityCapacity(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 2)
+	rl.Add(1, &testOp{})
+	rl.Add(1, &testOp{})
+
+	if err := rl.GrantPriorityCapacity(1, 2, 30*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := rl.Add(1, &testOp{}); err != nil {
+			t.Fatal("extra operations should be accepted during the grant", err)
+		}
+	}
+	if err := rl.Add(1, &testOp{}); err != ErrPriorityCapacity {
+		t.Fatal("the grant should be limited", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	rl.tick(time.Now())
+	if err := rl.Add(1, &testOp{}); err != ErrPriorityCapacity {
+		t.Fatal("operations should be rejected after the grant lapses", err)
+	}
+}
+
+func TestScheduler_TakePriority(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+	for i := 0; i < 3; i++ {
+		rl.Add(1, &testOp{T: i})
+	}
+	rl.Add(2, &testOp{})
+
+	ops := rl.TakePriority(1)
+	if len(ops) != 3 {
+		t.Fatal("every operation of the priority should be taken", len(ops))
+	}
+	for i, o := range ops {
+		if o.(*testOp).T != i {
+			t.Fatal("operations should be taken in FIFO order")
+		}
+	}
+	if len(rl.PendingPriority(1)) != 0 || rl.curops != 1 {
+		t.Fatal("the priority should be empty", rl.curops)
+	}
+	if rl.TakePriority(3) != nil {
+		t.Fatal("unknown priority should return nil")
+	}
+}
+
+func TestScheduler_TakePriorityMove(t *testing.T) {
+	a, b := newManual(Config{}), newManual(Config{})
+	defer a.Stop()
+	defer b.Stop()
+	a.InitPriority(1, 0)
+	b.InitPriority(1, 0)
+
+	chunks := 0
+	a.AddChunked(1, ClosureChunked(func() bool {
+		chunks++
+		return chunks < 2
+	}))
+	for _, o := range a.TakePriority(1) {
+		b.Add(1, o)
+	}
+
+	b.tick(time.Now())
+	if a.curops != 0 || b.curops != 1 {
+		t.Fatal("the next chunk should be added to the new scheduler", a.curops, b.curops)
+	}
+	b.tick(time.Now())
+	if chunks != 2 || b.curops != 0 {
+		t.Fatal("the moved operation should finish on the new scheduler", chunks, b.curops)
+	}
+}
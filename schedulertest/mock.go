@@ -0,0 +1,136 @@
+// Package schedulertest provides a MockScheduler that can replace a
+// scheduler.Scheduler in tests, without goroutines or timing.
+package schedulertest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	scheduler "github.com/boljen/go-scheduler"
+)
+
+// MockScheduler records the operations that are added to it and executes
+// them on demand, in the same order a Scheduler would dispatch them: the
+// highest priority first, in FIFO order within a priority.
+// Priorities don't need to be initialized.
+type MockScheduler struct {
+	mu      sync.Mutex
+	ops     map[scheduler.Priority][]scheduler.Operation
+	inited  map[scheduler.Priority]bool
+	pauses  []time.Duration
+	stopped bool
+}
+
+var _ scheduler.SchedulerInterface = (*MockScheduler)(nil)
+
+// NewMock creates a new MockScheduler without any operations.
+func NewMock() *MockScheduler {
+	return &MockScheduler{
+		ops:    make(map[scheduler.Priority][]scheduler.Operation),
+		inited: make(map[scheduler.Priority]bool),
+	}
+}
+
+// Add records the operation.
+func (m *MockScheduler) Add(p scheduler.Priority, o scheduler.Operation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ops[p] = append(m.ops[p], o)
+	return nil
+}
+
+// InitPriority records the priority. Like Scheduler.InitPriority it returns
+// false when the priority has already been initialized, either by an earlier
+// call or by adding an operation to it.
+func (m *MockScheduler) InitPriority(p scheduler.Priority, maxops int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.ops[p]; ok || m.inited[p] {
+		return false
+	}
+	m.inited[p] = true
+	return true
+}
+
+// Pause records the duration of the pause, it doesn't pause Run.
+func (m *MockScheduler) Pause(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pauses = append(m.pauses, d)
+}
+
+// Stop marks the mock as stopped.
+func (m *MockScheduler) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped = true
+}
+
+// Operations returns the pending operations in dispatch order.
+func (m *MockScheduler) Operations() []scheduler.Operation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ops []scheduler.Operation
+	for _, p := range m.priorities() {
+		ops = append(ops, m.ops[p]...)
+	}
+	return ops
+}
+
+// RunNext executes the next pending operation from within the calling
+// goroutine. It returns false when no operations are pending.
+func (m *MockScheduler) RunNext() bool {
+	m.mu.Lock()
+	var o scheduler.Operation
+	for _, p := range m.priorities() {
+		if len(m.ops[p]) > 0 {
+			o = m.ops[p][0]
+			m.ops[p] = m.ops[p][1:]
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if o == nil {
+		return false
+	}
+	o.Execute()
+	return true
+}
+
+// RunAll executes pending operations until none are left, including the
+// operations that are added while running. It returns the amount of
+// executed operations.
+func (m *MockScheduler) RunAll() int {
+	n := 0
+	for m.RunNext() {
+		n++
+	}
+	return n
+}
+
+// Pauses returns the durations of the pauses that were requested.
+func (m *MockScheduler) Pauses() []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]time.Duration(nil), m.pauses...)
+}
+
+// Stopped returns whether Stop has been called.
+func (m *MockScheduler) Stopped() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stopped
+}
+
+// priorities returns the priorities from high to low.
+// The caller must hold the lock.
+func (m *MockScheduler) priorities() []scheduler.Priority {
+	ps := make([]scheduler.Priority, 0, len(m.ops))
+	for p := range m.ops {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i] > ps[j] })
+	return ps
+}
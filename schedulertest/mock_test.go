@@ -0,0 +1,60 @@
+package schedulertest
+
+import (
+	"testing"
+	"time"
+
+	scheduler "github.com/boljen/go-scheduler"
+)
+
+func TestMockScheduler(t *testing.T) {
+	var s scheduler.SchedulerInterface = NewMock()
+	m := s.(*MockScheduler)
+
+	var order []int
+	record := func(i int) scheduler.Operation {
+		return scheduler.Closure(func() { order = append(order, i) })
+	}
+	s.Add(1, record(3))
+	s.Add(5, record(1))
+	s.Add(1, record(4))
+	s.Add(5, record(2))
+	if len(m.Operations()) != 4 {
+		t.Fatal("operations should be recorded")
+	}
+	if len(order) != 0 {
+		t.Fatal("operations must not execute until requested")
+	}
+
+	if n := m.RunAll(); n != 4 {
+		t.Fatal("wrong amount of executed operations", n)
+	}
+	for i, v := range order {
+		if v != i+1 {
+			t.Fatal("operations should replay in priority order", order)
+		}
+	}
+	if m.RunNext() {
+		t.Fatal("no operations should be left")
+	}
+
+	s.Pause(time.Second)
+	s.Stop()
+	if len(m.Pauses()) != 1 || !m.Stopped() {
+		t.Fatal("pause and stop should be recorded")
+	}
+}
+
+func TestMockSchedulerInitPriority(t *testing.T) {
+	m := NewMock()
+	if !m.InitPriority(1, 0) {
+		t.Fatal("the first call should initialize the priority")
+	}
+	if m.InitPriority(1, 0) {
+		t.Fatal("the priority is already initialized")
+	}
+	m.Add(2, scheduler.Closure(func() {}))
+	if m.InitPriority(2, 0) {
+		t.Fatal("adding an operation should initialize the priority")
+	}
+}
@@ -0,0 +1,99 @@
+package scheduler
+
+// Selection is a strategy used to select the priority of the next operation.
+type Selection int
+
+// These are the available selection strategies.
+const (
+	// SelectStrict always selects the highest priority that has pending
+	// operations. Lower priorities starve as long as higher priorities have
+	// work.
+	SelectStrict Selection = iota
+
+	// SelectWeightedRandom selects one of the priorities that have pending
+	// operations at random, with a probability proportional to their weight.
+	// This favors heavy priorities without starving light ones.
+	SelectWeightedRandom
+)
+
+// PriorityOrder determines which priorities are dispatched first.
+type PriorityOrder int
+
+// These are the available priority orders.
+const (
+	// HigherFirst dispatches the operations of the priorities with the
+	// highest value first. This is the default.
+	HigherFirst PriorityOrder = iota
+
+	// LowerFirst dispatches the operations of the priorities with the
+	// lowest value first, e.g. when priority 1 means the most urgent.
+	LowerFirst
+)
+
+// SetPriorityWeight sets the weight of a priority that is used by the
+// SelectWeightedRandom strategy. Every priority has a weight of 1 by default.
+// Priorities with a weight of 0 or less are only selected when no other
+// priority has pending operations.
+func (s *Scheduler) SetPriorityWeight(p Priority, w float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pm, err := s.getPriorityMetadata(s.mapPriority(p))
+	if err != nil {
+		return err
+	}
+	pm.weight = w
+	return nil
+}
+
+// getWeightedOp removes and returns an operation of a priority that is
+// selected at random, proportional to the weights of the priorities that
+// have operations available. The caller must hold the lock.
+func (s *Scheduler) getWeightedOp() (queuedOp, bool) {
+	var total float64
+	var fallback *priorityMetadata
+	for i := len(s.opl) - 1; i >= 0; i-- {
+		pm := s.opl[i]
+		if _, ok := s.eligible(pm); !ok {
+			continue
+		}
+		if pm.weight > 0 {
+			total += pm.weight
+		} else if fallback == nil {
+			fallback = pm
+		}
+	}
+
+	if total > 0 {
+		r := s.weights.Float64() * total
+		for i := len(s.opl) - 1; i >= 0; i-- {
+			pm := s.opl[i]
+			if pm.weight <= 0 {
+				continue
+			}
+			if _, ok := s.eligible(pm); !ok {
+				continue
+			}
+			if r -= pm.weight; r < 0 {
+				return s.takeFrom(pm)
+			}
+		}
+	}
+	if fallback != nil {
+		return s.takeFrom(fallback)
+	}
+	return queuedOp{}, false
+}
+
+// getFairOp removes and returns an operation of the priorities with pending
+// operations in turn, regardless of their priority.
+// The caller must hold the lock.
+func (s *Scheduler) getFairOp() (queuedOp, bool) {
+	for k := 0; k < len(s.opl) && !s.overBudget; k++ {
+		i := (s.turn + k) % len(s.opl)
+		if q, ok := s.takeFrom(s.opl[i]); ok {
+			s.turn = i + 1
+			return q, true
+		}
+	}
+	return queuedOp{}, false
+}
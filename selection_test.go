@@ -0,0 +1,163 @@
+package scheduler
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSchedulerWeightedRandom(t *testing.T) {
+	rl := newManual(Config{Selection: SelectWeightedRandom})
+	defer rl.Stop()
+	weights := map[Priority]float64{1: 1, 2: 3, 3: 6}
+	for p, w := range weights {
+		rl.InitPriority(p, 0)
+		if err := rl.SetPriorityWeight(p, w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rl.SetPriorityWeight(4, 1); err != ErrInvalidPriority {
+		t.Fatal("expected ErrInvalidPriority")
+	}
+
+	const n = 10000
+	counts := make(map[Priority]int)
+	for i := 0; i < n; i++ {
+		// Keep every priority non-empty so each of them is always eligible.
+		for p := range weights {
+			if len(rl.PendingPriority(p)) == 0 {
+				rl.Add(p, &testOp{})
+			}
+		}
+		q, ok := rl.getNextOp()
+		if !ok {
+			t.Fatal("an operation should be available")
+		}
+		counts[q.priority]++
+	}
+
+	for p, w := range weights {
+		want := w / 10
+		if got := float64(counts[p]) / n; math.Abs(got-want) > 0.03 {
+			t.Fatal("priority", p, "selected", got, "of the time, want", want)
+		}
+	}
+}
+
+func TestSchedulerWeightedRandomZeroWeight(t *testing.T) {
+	rl := newManual(Config{Selection: SelectWeightedRandom})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+	rl.SetPriorityWeight(1, 0)
+	rl.Add(1, &testOp{1})
+	rl.Add(2, &testOp{2})
+
+	if q, _ := rl.getNextOp(); q.priority != 2 {
+		t.Fatal("a weightless priority should only be selected when nothing else is available")
+	}
+	if q, _ := rl.getNextOp(); q.priority != 1 {
+		t.Fatal("a weightless priority should be selected when nothing else is available")
+	}
+	if _, ok := rl.getNextOp(); ok {
+		t.Fatal("no operation should be available")
+	}
+}
+
+func TestSchedulerPostPauseFairness(t *testing.T) {
+	rl := newManual(Config{PostPauseFairness: true})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	rl.Pause(10 * time.Millisecond)
+	var order []Priority
+	for i := 0; i < 4; i++ {
+		rl.Add(2, Closure(func() { order = append(order, 2) }))
+		rl.Add(1, Closure(func() { order = append(order, 1) }))
+	}
+	rl.tick(time.Now())
+	time.Sleep(20 * time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		rl.tick(time.Now())
+	}
+	low := 0
+	for _, p := range order {
+		if p == 1 {
+			low++
+		}
+	}
+	if len(order) != 4 || low != 2 {
+		t.Fatal("low priority starved during the recovery", order)
+	}
+
+	// Once the backlog has drained, strict selection applies again.
+	for i := 0; i < 4; i++ {
+		rl.tick(time.Now())
+	}
+	rl.Add(1, Closure(func() { order = append(order, 1) }))
+	rl.Add(2, Closure(func() { order = append(order, 2) }))
+	rl.tick(time.Now())
+	if order[len(order)-1] != 2 {
+		t.Fatal("strict selection should apply after the recovery", order)
+	}
+}
+
+func TestSchedulerPriorityOrder(t *testing.T) {
+	for _, order := range []PriorityOrder{HigherFirst, LowerFirst} {
+		rl := newManual(Config{PriorityOrder: order})
+		rl.InitPriority(1, 0)
+		rl.InitPriority(10, 0)
+		rl.InitPriority(5, 0)
+		rl.Priorities()[0] = 99
+		ps, dispatch := rl.Priorities(), []Priority{10, 5, 1}
+		if order == LowerFirst {
+			dispatch = []Priority{1, 5, 10}
+		}
+		if len(ps) != 3 || ps[0] != dispatch[0] || ps[1] != dispatch[1] || ps[2] != dispatch[2] {
+			t.Fatal("wrong dispatch order", order, ps)
+		}
+		var executed []Priority
+		rl.Add(1, Closure(func() { executed = append(executed, 1) }))
+		rl.Add(10, Closure(func() { executed = append(executed, 10) }))
+		rl.tick(time.Now())
+		rl.Stop()
+
+		want := Priority(10)
+		if order == LowerFirst {
+			want = 1
+		}
+		if len(executed) != 1 || executed[0] != want {
+			t.Fatal("wrong priority dispatched first", order, executed)
+		}
+	}
+}
+
+type costOp struct {
+	cost int
+	ran  *[]int
+}
+
+func (o costOp) Execute() { *o.ran = append(*o.ran, o.cost) }
+
+func TestSchedulerLess(t *testing.T) {
+	rl := newManual(Config{Less: func(a, b QueuedOp) bool {
+		return a.Operation.(costOp).cost < b.Operation.(costOp).cost
+	}})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	var ran []int
+	for _, c := range []int{5, 1, 3} {
+		rl.Add(1, costOp{c, &ran})
+	}
+	rl.Add(2, costOp{9, &ran})
+	for i := 0; i < 4; i++ {
+		rl.tick(time.Now())
+	}
+	if len(ran) != 4 || ran[0] != 9 || ran[1] != 1 || ran[2] != 3 || ran[3] != 5 {
+		t.Fatal("the cheapest operation of a priority should be dispatched first", ran)
+	}
+}
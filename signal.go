@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// HandleSignals installs a handler that shuts the scheduler down gracefully
+// when one of the signals is received: it waits at most grace for the
+// pending operations to be dispatched, after which it stops the scheduler.
+// The returned function removes the handler, it's a no-op after a signal
+// has been handled.
+func (s *Scheduler) HandleSignals(grace time.Duration, sigs ...os.Signal) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	quit := make(chan struct{})
+	go func() {
+		s.awaitSignal(ch, quit, grace)
+		signal.Stop(ch)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(quit) })
+	}
+}
+
+// awaitSignal drains and stops the scheduler when a signal is received on
+// ch, unless quit is closed first.
+func (s *Scheduler) awaitSignal(ch <-chan os.Signal, quit <-chan struct{}, grace time.Duration) {
+	select {
+	case <-ch:
+	case <-quit:
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	s.Drain(ctx)
+	s.Stop()
+}
@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerAwaitSignal(t *testing.T) {
+	stopped := false
+	rl := New(Config{OPS: 100, OnStop: func() { stopped = true }})
+	rl.InitPriority(1, 0)
+	var executed int32
+	for i := 0; i < 5; i++ {
+		rl.Add(1, Closure(func() { atomic.AddInt32(&executed, 1) }))
+	}
+
+	ch := make(chan os.Signal, 1)
+	ch <- os.Interrupt
+	rl.awaitSignal(ch, nil, time.Second)
+	if !stopped || atomic.LoadInt32(&executed) != 5 {
+		t.Fatal("scheduler should drain and stop on a signal", stopped, executed)
+	}
+}
+
+func TestSchedulerHandleSignalsCancel(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	cancel := rl.HandleSignals(time.Second, os.Interrupt)
+	cancel()
+	cancel()
+}
@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// sourceTick is a tick of an additional tick source.
+type sourceTick struct {
+	source int
+	t      time.Time
+}
+
+// processSource forwards the ticks of an additional tick source to the
+// main tick loop until stop is closed. The channels are passed in so a
+// Reset can't replace them while the goroutine is still running.
+func (s *Scheduler) processSource(source int, d time.Duration, stop <-chan struct{}, ticks chan<- sourceTick) {
+	defer s.sources.Done()
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case t := <-ticker.C:
+			select {
+			case ticks <- sourceTick{source, t}:
+			case <-stop:
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// SourceCounts returns the amount of operations dispatched by every tick
+// source. The first count belongs to OPS, the others to the Sources in the
+// order they were configured.
+func (s *Scheduler) SourceCounts() []uint64 {
+	counts := make([]uint64, len(s.sourceCounts))
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&s.sourceCounts[i])
+	}
+	return counts
+}
@@ -0,0 +1,38 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerSources(t *testing.T) {
+	rl := New(Config{OPS: 10, Sources: []float32{20}})
+	rl.InitPriority(1, 0)
+	for i := 0; i < 100; i++ {
+		rl.Add(1, &testOp{})
+	}
+	time.Sleep(time.Second)
+	rl.Stop()
+
+	counts := rl.SourceCounts()
+	if len(counts) != 2 {
+		t.Fatal("wrong amount of sources", counts)
+	}
+	if counts[0] < 8 || counts[0] > 11 || counts[1] < 17 || counts[1] > 21 {
+		t.Fatal("every source should dispatch at its own rate", counts)
+	}
+	if total := counts[0] + counts[1]; total < 25 || total > 31 {
+		t.Fatal("combined rate should be the sum of the sources", total)
+	}
+}
+
+func TestSchedulerSourcesReset(t *testing.T) {
+	rl := New(Config{OPS: 1000, Sources: []float32{1000}})
+	time.Sleep(10 * time.Millisecond)
+	rl.Stop()
+	if err := rl.Reset(Config{OPS: 1000, Sources: []float32{1000}}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	rl.Stop()
+}
@@ -0,0 +1,30 @@
+package scheduler
+
+import "time"
+
+// starvation is a priority whose oldest operation waits too long.
+type starvation struct {
+	p      Priority
+	waited time.Duration
+}
+
+// starving returns the priorities whose oldest operation has waited longer
+// than the starvation threshold. Every operation is only reported once.
+// The caller must hold the lock.
+func (s *Scheduler) starving(now time.Time) []starvation {
+	var starved []starvation
+	for _, pm := range s.opl {
+		if pm.curops == 0 {
+			continue
+		}
+		q := pm.at(0)
+		if q.id == pm.starved {
+			continue
+		}
+		if waited := now.Sub(q.enqueued); waited > s.starvationThreshold {
+			pm.starved = q.id
+			starved = append(starved, starvation{pm.priority, waited})
+		}
+	}
+	return starved
+}
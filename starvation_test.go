@@ -0,0 +1,35 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerOnStarvation(t *testing.T) {
+	starved := make(map[Priority]int)
+	rl := newManual(Config{
+		StarvationThreshold: 10 * time.Millisecond,
+		OnStarvation: func(p Priority, waited time.Duration) {
+			if waited <= 10*time.Millisecond {
+				t.Fatal("reported before the threshold", waited)
+			}
+			starved[p]++
+		},
+	})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	rl.Add(1, &testOp{})
+	for i := 0; i < 10; i++ {
+		rl.Add(2, &testOp{})
+	}
+	rl.tick(time.Now())
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		rl.tick(time.Now())
+	}
+	if starved[1] != 1 {
+		t.Fatal("the starved priority should be reported once", starved)
+	}
+}
@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Tagged is an operation that exposes a tag, which is used to break down
+// the statistics of a scheduler that runs different kinds of operations.
+type Tagged interface {
+	Tag() string
+}
+
+// Stats contains the statistics of a Scheduler.
+type Stats struct {
+	// Dispatched is the amount of operations that were dispatched.
+	Dispatched uint64 `json:"dispatched"`
+
+	// Tags is the amount of dispatched operations per tag. Operations that
+	// don't implement Tagged are counted under the empty tag.
+	Tags map[string]uint64 `json:"tags"`
+
+	// FallbackRuns is the amount of times the fallback was executed.
+	FallbackRuns uint64 `json:"fallback_runs"`
+}
+
+// Stats returns a snapshot of the statistics of the scheduler.
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats()
+}
+
+// stats returns a snapshot of the statistics of the scheduler.
+// The caller must hold the lock.
+func (s *Scheduler) stats() Stats {
+	st := Stats{
+		Tags:         make(map[string]uint64, len(s.tags)),
+		FallbackRuns: atomic.LoadUint64(&s.fallbackRuns),
+	}
+	for tag, n := range s.tags {
+		st.Tags[tag] = n
+		st.Dispatched += n
+	}
+	return st
+}
+
+// count adds a dispatched operation to the statistics.
+// The caller must hold the lock.
+func (s *Scheduler) count(o Operation) {
+	if t, ok := unwrap(o).(Tagged); ok {
+		s.tags[t.Tag()]++
+		return
+	}
+	s.tags[""]++
+}
+
+// rateWindow is the amount of seconds PriorityRate is computed over.
+const rateWindow = 10
+
+// rateBucket counts the dispatched operations of a single second.
+type rateBucket struct {
+	sec int64
+	n   uint32
+}
+
+// rateHistory counts the dispatched operations of a priority per second,
+// over the last rateWindow seconds.
+type rateHistory [rateWindow]rateBucket
+
+// record counts an operation that was dispatched at now.
+func (h *rateHistory) record(now time.Time) {
+	sec := now.Unix()
+	b := &h[sec%rateWindow]
+	if b.sec != sec {
+		b.sec, b.n = sec, 0
+	}
+	b.n++
+}
+
+// rate returns the average amount of operations per second over the window.
+func (h *rateHistory) rate(now time.Time) float64 {
+	var n uint32
+	sec := now.Unix()
+	for _, b := range h {
+		if b.sec > sec-rateWindow && b.sec <= sec {
+			n += b.n
+		}
+	}
+	return float64(n) / rateWindow
+}
+
+// PriorityRate returns the amount of operations of the priority that were
+// dispatched per second, on average over the last 10 seconds. It returns 0
+// for unknown priorities.
+func (s *Scheduler) PriorityRate(p Priority) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pm, ok := s.pl[s.mapPriority(p)]
+	if !ok {
+		return 0
+	}
+	return pm.history.rate(time.Now())
+}
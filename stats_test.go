@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+type taggedOp struct {
+	testOp
+	tag string
+}
+
+func (o *taggedOp) Tag() string { return o.tag }
+
+func TestSchedulerStats(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	rl.Add(1, &taggedOp{tag: "search"})
+	rl.Add(1, &taggedOp{tag: "profile"})
+	rl.Add(1, &taggedOp{tag: "search"})
+	rl.Add(1, &testOp{})
+	rl.AddErr(1, ClosureErr(func() error { return nil }))
+	for i := 0; i < 5; i++ {
+		rl.tick(time.Now())
+	}
+
+	st := rl.Stats()
+	if st.Dispatched != 5 {
+		t.Fatal("wrong amount of dispatched operations", st.Dispatched)
+	}
+	if st.Tags["search"] != 2 || st.Tags["profile"] != 1 || st.Tags[""] != 2 {
+		t.Fatal("wrong tallies", st.Tags)
+	}
+}
+
+func TestSchedulerStatsWrapped(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	rl.AddReliable(1, &taggedOp{tag: "reliable"}, 1)
+	rl.AddWithCallback(1, &taggedOp{tag: "callback"}, func(error) {})
+	for i := 0; i < 2; i++ {
+		rl.tick(time.Now())
+	}
+	if st := rl.Stats(); st.Tags["reliable"] != 1 || st.Tags["callback"] != 1 {
+		t.Fatal("wrapped operations should be counted under their tag", st.Tags)
+	}
+}
+
+func TestSchedulerStatsFallbackRuns(t *testing.T) {
+	rl := newManual(Config{Fallback: Closure(func() {})})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+
+	rl.tick(time.Now())
+	rl.tick(time.Now())
+	rl.Add(1, &testOp{})
+	rl.tick(time.Now())
+	if n := rl.Stats().FallbackRuns; n != 2 {
+		t.Fatal("only idle ticks should run the fallback", n)
+	}
+}
+
+func TestSchedulerPriorityRate(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+	for i := 0; i < 10; i++ {
+		rl.Add(1, &testOp{})
+		rl.Add(2, &testOp{})
+	}
+	for i := 0; i < 10; i++ {
+		rl.tick(time.Now())
+	}
+
+	if r := rl.PriorityRate(2); r != 1 {
+		t.Fatal("high priority should dominate the rate", r)
+	}
+	if r := rl.PriorityRate(1); r != 0 {
+		t.Fatal("low priority should be starved", r)
+	}
+}
+
+func TestSchedulerStatsReset(t *testing.T) {
+	rl := newManual(Config{Fallback: Closure(func() {})})
+	rl.InitPriority(1, 0)
+	rl.tick(time.Now())
+	rl.Stop()
+	if err := rl.Reset(Config{}); err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Stop()
+	if n := rl.Stats().FallbackRuns; n != 0 {
+		t.Fatal("a reset should clear the fallback runs", n)
+	}
+}
@@ -0,0 +1,35 @@
+package scheduler
+
+import "time"
+
+// wakeUp signals the tick loop of an unlimited scheduler that an operation
+// was added. The caller must hold the lock.
+func (s *Scheduler) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runUnlimited dispatches operations without waiting for ticks until no
+// operation can be dispatched, the scheduler is paused or it's stopped.
+// These dispatches aren't ticks, so they don't count as such and skip the
+// bookkeeping of a tick.
+func (s *Scheduler) runUnlimited() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		s.mu.Lock()
+		paused := time.Now().Before(s.pause)
+		s.mu.Unlock()
+		if paused {
+			return
+		}
+		if dispatched, _ := s.dispatchNext(); !dispatched {
+			return
+		}
+	}
+}
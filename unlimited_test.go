@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerUnlimited(t *testing.T) {
+	var mu sync.Mutex
+	var order []Priority
+	rl := New(Config{OPS: 20, Unlimited: true, PriorityAutoInit: true})
+	defer rl.Stop()
+
+	rl.Pause(10 * time.Millisecond)
+	for i := 0; i < 25; i++ {
+		for _, p := range []Priority{1, 2} {
+			p := p
+			rl.Add(p, Closure(func() {
+				mu.Lock()
+				order = append(order, p)
+				mu.Unlock()
+			}))
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 50 {
+		t.Fatal("all operations should execute without waiting for ticks", len(order))
+	}
+	for i, p := range order {
+		if (i < 25) != (p == 2) {
+			t.Fatal("operations should execute in order of priority", order)
+		}
+	}
+}
+
+func TestSchedulerUnlimitedTicks(t *testing.T) {
+	rl := New(Config{OPS: 1, Unlimited: true, PriorityAutoInit: true})
+	defer rl.Stop()
+
+	for i := 0; i < 100; i++ {
+		rl.Add(1, &testOp{})
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := rl.TicksProcessed(); n > 1 {
+		t.Fatal("unlimited dispatches must not count as ticks", n)
+	}
+	if st := rl.Stats(); st.Dispatched != 100 {
+		t.Fatal("all operations should be dispatched", st.Dispatched)
+	}
+}
@@ -0,0 +1,68 @@
+package scheduler
+
+// QueueEventType indicates how the queue has changed.
+type QueueEventType int
+
+// These are the possible changes of the queue.
+const (
+	QueueEnqueue QueueEventType = iota // An operation has been added.
+	QueueDequeue                       // An operation has been dispatched.
+)
+
+// QueueEvent describes a change of the queue and the depths that result
+// from it.
+type QueueEvent struct {
+	Type          QueueEventType
+	Priority      Priority // The priority of the operation.
+	Depth         int      // The amount of pending operations.
+	PriorityDepth int      // The amount of pending operations of the priority.
+}
+
+// watchBuffer is the capacity of the channels returned by Watch.
+const watchBuffer = 64
+
+// Watch returns a channel that receives an event every time an operation is
+// added to or dispatched from the queue. Events are dropped when the channel
+// is full, so a slow consumer never stalls the scheduler but might miss
+// events. Use Health for an exact snapshot.
+// The channel is closed when the scheduler is stopped.
+func (s *Scheduler) Watch() <-chan QueueEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan QueueEvent, watchBuffer)
+	if s.stopped {
+		close(ch)
+		return ch
+	}
+	s.watchers = append(s.watchers, ch)
+	return ch
+}
+
+// notify sends an event to every watcher without blocking.
+// The caller must hold the lock.
+func (s *Scheduler) notify(t QueueEventType, pm *priorityMetadata) {
+	if len(s.watchers) == 0 {
+		return
+	}
+	e := QueueEvent{
+		Type:          t,
+		Priority:      pm.priority,
+		Depth:         int(s.curops),
+		PriorityDepth: int(pm.curops),
+	}
+	for _, ch := range s.watchers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// closeWatchers closes the channels of every watcher.
+// The caller must hold the lock.
+func (s *Scheduler) closeWatchers() {
+	for _, ch := range s.watchers {
+		close(ch)
+	}
+	s.watchers = nil
+}
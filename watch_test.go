@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerWatch(t *testing.T) {
+	rl := newManual(Config{})
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+	events := rl.Watch()
+
+	rl.Add(1, &testOp{})
+	rl.Add(2, &testOp{})
+	rl.tick(time.Now())
+
+	want := []QueueEvent{
+		{QueueEnqueue, 1, 1, 1},
+		{QueueEnqueue, 2, 2, 1},
+		{QueueDequeue, 2, 1, 0},
+	}
+	for _, w := range want {
+		if e := <-events; e != w {
+			t.Fatal("unexpected event", e, w)
+		}
+	}
+
+	rl.Stop()
+	if _, ok := <-events; ok {
+		t.Fatal("channel should be closed on stop")
+	}
+}
+
+func TestSchedulerWatchSlowConsumer(t *testing.T) {
+	rl := newManual(Config{})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	events := rl.Watch()
+
+	// Nobody reads the events, adding must not block.
+	for i := 0; i < watchBuffer*2; i++ {
+		rl.Add(1, &testOp{})
+	}
+	if len(events) != watchBuffer {
+		t.Fatal("events should be dropped when the channel is full")
+	}
+}
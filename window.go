@@ -0,0 +1,58 @@
+package scheduler
+
+import "time"
+
+// advanceWindow counts a tick against the current scheduling window and
+// resets the quotas when a new window starts. The caller must hold the lock.
+func (s *Scheduler) advanceWindow(t time.Time) {
+	s.windowTick++
+	if s.windowTick <= s.window {
+		return
+	}
+	s.windowTick = 1
+	for _, pm := range s.opl {
+		if pm.quota != nil {
+			pm.quota.start = t
+			pm.quota.used = 0
+		}
+	}
+}
+
+// windowOp removes and returns the next pending operation within a
+// scheduling window. The caller must hold the lock.
+func (s *Scheduler) windowOp() (queuedOp, bool) {
+	if s.quotas > 0 {
+		if q, ok := s.windowQuotaOp(); ok {
+			return q, true
+		}
+	}
+	return s.strictOp()
+}
+
+// windowQuotaOp takes the next operation of the most urgent priority that
+// is behind its quota, but only once the remaining ticks of the window are
+// needed to meet the outstanding quotas. The caller must hold the lock.
+func (s *Scheduler) windowQuotaOp() (queuedOp, bool) {
+	outstanding := 0
+	for _, pm := range s.opl {
+		if pm.quota == nil || pm.quota.used >= pm.quota.n {
+			continue
+		}
+		if _, ok := s.eligible(pm); ok {
+			outstanding += pm.quota.n - pm.quota.used
+		}
+	}
+	if outstanding == 0 || outstanding < s.window-s.windowTick+1 {
+		return queuedOp{}, false
+	}
+	for i := len(s.opl) - 1; i >= 0 && !s.overBudget; i-- {
+		pm := s.opl[i]
+		if pm.quota == nil || pm.quota.used >= pm.quota.n {
+			continue
+		}
+		if q, ok := s.takeFrom(pm); ok {
+			return q, true
+		}
+	}
+	return queuedOp{}, false
+}
@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerWindow(t *testing.T) {
+	rl := newManual(Config{Window: 5})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+	rl.SetPriorityQuota(1, 2, time.Second)
+
+	var order []Priority
+	for i := 0; i < 20; i++ {
+		rl.Add(1, Closure(func() { order = append(order, 1) }))
+		rl.Add(2, Closure(func() { order = append(order, 2) }))
+	}
+	for i := 0; i < 10; i++ {
+		rl.tick(time.Now())
+	}
+
+	// Within every window the high priority is served first, and the quota
+	// of the low priority is met at the end of the window.
+	want := []Priority{2, 2, 2, 1, 1, 2, 2, 2, 1, 1}
+	if len(order) != len(want) {
+		t.Fatal("wrong amount of dispatched operations", order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatal("wrong dispatch order", order)
+		}
+	}
+}
+
+func TestSchedulerWindowStrict(t *testing.T) {
+	rl := newManual(Config{Window: 5, Selection: SelectWeightedRandom})
+	defer rl.Stop()
+	rl.InitPriority(1, 0)
+	rl.InitPriority(2, 0)
+
+	var order []Priority
+	for i := 0; i < 5; i++ {
+		rl.Add(1, Closure(func() { order = append(order, 1) }))
+		rl.Add(2, Closure(func() { order = append(order, 2) }))
+	}
+	for i := 0; i < 10; i++ {
+		rl.tick(time.Now())
+	}
+	if len(order) != 10 {
+		t.Fatal("wrong amount of dispatched operations", order)
+	}
+	for i, p := range order {
+		if (i < 5) != (p == 2) {
+			t.Fatal("the high priority should drain before the low priority", order)
+		}
+	}
+}
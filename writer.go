@@ -0,0 +1,49 @@
+package scheduler
+
+import "io"
+
+// SchedulerWriter is an io.Writer that paces writes to an underlying writer
+// using a Scheduler. Every call to Write is added to the scheduler as an
+// operation and blocks until that operation has been executed.
+type SchedulerWriter struct {
+	s *Scheduler
+	p Priority
+	w io.Writer
+}
+
+// NewWriter creates a new SchedulerWriter that writes to w using priority p
+// of the scheduler.
+func NewWriter(s *Scheduler, p Priority, w io.Writer) *SchedulerWriter {
+	return &SchedulerWriter{
+		s: s,
+		p: p,
+		w: w,
+	}
+}
+
+// Write schedules a write of b to the underlying writer and blocks until it
+// has been performed. Errors returned by the scheduler are returned as-is,
+// in which case nothing has been written. When the write is dropped before
+// it's performed, e.g. because the scheduler is stopped, the *DropError is
+// returned. During a dry run the write is reported as performed. When a
+// DrainHandler is configured, a write that is pending on Stop blocks until
+// the handler executes it.
+func (sw *SchedulerWriter) Write(b []byte) (int, error) {
+	var n int
+	var err error
+	written := false
+	done := make(chan error, 1)
+	if err := sw.s.AddWithCallback(sw.p, Closure(func() {
+		n, err = sw.w.Write(b)
+		written = true
+	}), func(err error) { done <- err }); err != nil {
+		return 0, err
+	}
+	if err := <-done; err != nil {
+		return 0, err
+	}
+	if !written {
+		return len(b), nil
+	}
+	return n, err
+}
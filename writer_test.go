@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type timedWriter struct {
+	bytes.Buffer
+	times []time.Time
+}
+
+func (w *timedWriter) Write(b []byte) (int, error) {
+	w.times = append(w.times, time.Now())
+	return w.Buffer.Write(b)
+}
+
+func TestSchedulerWriter(t *testing.T) {
+	rl := New(Config{OPS: 10})
+	defer rl.Stop()
+
+	tw := &timedWriter{}
+	w := NewWriter(rl, 1, tw)
+	if _, err := w.Write([]byte("a")); err != ErrInvalidPriority {
+		t.Fatal("expected ErrInvalidPriority")
+	}
+
+	rl.InitPriority(1, 0)
+	for _, s := range []string{"a", "b", "c", "d"} {
+		if n, err := w.Write([]byte(s)); err != nil || n != 1 {
+			t.Fatal("write failed", n, err)
+		}
+	}
+
+	if tw.String() != "abcd" {
+		t.Fatal("wrong output", tw.String())
+	}
+	for i := 1; i < len(tw.times); i++ {
+		if gap := tw.times[i].Sub(tw.times[i-1]); gap < 80*time.Millisecond {
+			t.Fatal("writes are spaced too closely", gap)
+		}
+	}
+}
+
+func TestSchedulerWriterDropped(t *testing.T) {
+	rl := New(Config{OPS: 10, PriorityAutoInit: true})
+	rl.Pause(time.Minute)
+	w := NewWriter(rl, 1, &bytes.Buffer{})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		rl.Stop()
+	}()
+	n, err := w.Write([]byte("hello"))
+	if de, ok := err.(*DropError); !ok || de.Reason != DropStopped || n != 0 {
+		t.Fatal("a dropped write should return the drop", n, err)
+	}
+}